@@ -42,7 +42,7 @@ goc clear --center=http://192.168.1.1:8080
 			Service: svrList,
 			Address: addrList,
 		}
-		res, err := cover.NewWorker(center).Clear(p)
+		res, err := centerWorker().Clear(p)
 		if err != nil {
 			log.Fatalf("call host %v failed, err: %v, response: %v", center, err, string(res))
 		}
@@ -20,6 +20,8 @@ import (
 	"fmt"
 	"net"
 
+	"github.com/qiniu/goc/pkg/cover"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
@@ -48,6 +50,15 @@ func addBasicFlags(cmdset *pflag.FlagSet) {
 	viper.BindPFlags(cmdset)
 }
 
+// centerWorker creates a worker to contact with the center, it exits if the center is invalid
+func centerWorker() cover.Action {
+	worker, err := cover.NewWorker(center)
+	if err != nil {
+		log.Fatalf("invalid center %v, err: %v", center, err)
+	}
+	return worker
+}
+
 func addCommonFlags(cmdset *pflag.FlagSet) {
 	addBasicFlags(cmdset)
 	cmdset.Var(&coverMode, "mode", "coverage mode: set, count, atomic")
@@ -77,8 +77,14 @@ var (
 
 	qiniuCredential string
 
-	robotName string
-	fullDiff  bool
+	robotName    string
+	fullDiff     bool
+	showStmts    bool
+	basisPoints  bool
+	minStmts     int
+	intersection bool
+	codeOwners   string
+	crossings    bool
 )
 
 func init() {
@@ -94,6 +100,12 @@ func init() {
 	diffCmd.Flags().StringVarP(&qiniuCredential, "qiniu-credential", "", "/etc/qiniuconfig/qiniu.json", "path to credential file to access qiniu cloud")
 	diffCmd.Flags().StringVarP(&robotName, "robot-name", "", "qiniu-bot", "github user name for coverage robot")
 	diffCmd.Flags().BoolVarP(&fullDiff, "full-diff", "", false, "when set true,calculate and display full diff coverage between new-profile and base-profile")
+	diffCmd.Flags().BoolVarP(&showStmts, "show-statements", "", false, "when set true, display the covered/total statement counts of the local profiles")
+	diffCmd.Flags().BoolVarP(&basisPoints, "basis-points", "", false, "when set true, display the delta of the local profiles in basis points")
+	diffCmd.Flags().IntVarP(&minStmts, "min-statements", "", 0, "omit the files with fewer statements in both local profiles from the diff, the total is unaffected")
+	diffCmd.Flags().BoolVarP(&intersection, "intersection", "", false, "when set true, only compare the files in both local profiles")
+	diffCmd.Flags().StringVarP(&codeOwners, "codeowners", "", "", "CODEOWNERS file used to annotate each file of the local profiles with its owners")
+	diffCmd.Flags().BoolVarP(&crossings, "flag-crossings", "", false, "when set true, flag the files of the local profiles crossing the coverage-threshold-percentage in either direction")
 
 	rootCmd.AddCommand(diffCmd)
 }
@@ -117,18 +129,37 @@ func doDiffForLocalProfiles(cmd *cobra.Command, args []string) {
 		logrus.Fatal(err)
 	}
 
+	opts := &cover.DiffReportOptions{ShowStmts: showStmts, BasisPoints: basisPoints, MinStmts: minStmts, Intersection: intersection}
+	if crossings {
+		if coverageThreshold <= 0 {
+			logrus.Fatalf("flag-crossings requires a positive coverage-threshold-percentage")
+		}
+		opts.FlagCrossings = true
+		opts.CrossThreshold = float32(coverageThreshold) / 100
+	}
+	if codeOwners != "" {
+		f, err := os.Open(codeOwners)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		opts.Owners, err = cover.ParseCodeOwners(f)
+		f.Close()
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
 	//calculate diff file cov and display
-	rows := cover.GetDeltaCov(localP, baseP)
-	rows.Sort()
+	header := cover.DiffReportHeader(opts)
 	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"File", "Base Coverage", "New Coverage", "Delta"})
+	table.SetHeader(header)
 	table.SetAutoFormatHeaders(false)
-	table.SetColumnAlignment([]int{tablewriter.ALIGN_LEFT, tablewriter.ALIGN_CENTER, tablewriter.ALIGN_CENTER, tablewriter.ALIGN_CENTER})
-	for _, row := range rows {
-		table.Append([]string{row.FileName, row.BasePer, row.NewPer, row.DeltaPer})
+	alignment := []int{tablewriter.ALIGN_LEFT}
+	for i := 1; i < len(header); i++ {
+		alignment = append(alignment, tablewriter.ALIGN_CENTER)
 	}
-	totalDelta := cover.PercentStr(cover.TotalDelta(localP, baseP))
-	table.Append([]string{"Total", baseP.TotalPercentage(), localP.TotalPercentage(), totalDelta})
+	table.SetColumnAlignment(alignment)
+	table.AppendBulk(cover.GenLocalCoverDiffReport(localP, baseP, opts))
 	table.Render()
 }
 
@@ -155,7 +186,10 @@ func doDiffUnderProw(cmd *cobra.Command, args []string) {
 		if githubToken == "" {
 			logrus.Fatalf("github token not provided")
 		}
-		prClient := github.NewPrClient(githubToken, repoOwner, repoName, prNumStr, robotName, githubCommentPrefix)
+		prClient, err := github.NewPrClient(githubToken, repoOwner, repoName, prNumStr, robotName, githubCommentPrefix)
+		if err != nil {
+			logrus.Fatal(err)
+		}
 
 		if qiniuCredential == "" {
 			logrus.Fatalf("qiniu credential not provided")
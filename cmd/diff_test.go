@@ -57,6 +57,7 @@ func TestDoDiffForLocalProfiles(t *testing.T) {
 		newProfile   string
 		baseCovFile  string
 		baseProfile  string
+		flags        map[string]string
 		expectOutput string
 	}{
 		{
@@ -74,6 +75,42 @@ func TestDoDiffForLocalProfiles(t *testing.T) {
 | qiniu.com/kodo/apiserver/server/main.go |     50.0%     |    100.0%    | 50.0% |
 | Total                                   |     50.0%     |    100.0%    | 50.0% |
 +-----------------------------------------+---------------+--------------+-------+
+`,
+		},
+		{
+			newCovFile:  "new.cov",
+			baseCovFile: "base.cov",
+			newProfile: "mode: atomic\n" +
+				"qiniu.com/kodo/apiserver/server/main.go:32.49,33.13 1 30\n" +
+				"qiniu.com/kodo/apiserver/server/main.go:42.49,43.13 1 1\n",
+			baseProfile: "mode: atomic\n" +
+				"qiniu.com/kodo/apiserver/server/main.go:32.49,33.13 1 30\n" +
+				"qiniu.com/kodo/apiserver/server/main.go:42.49,43.13 1 0\n",
+			flags: map[string]string{"coverage-threshold-percentage": "80"},
+			expectOutput: `+-----------------------------------------+---------------+--------------+-------+
+|                  File                   | Base Coverage | New Coverage | Delta |
++-----------------------------------------+---------------+--------------+-------+
+| qiniu.com/kodo/apiserver/server/main.go |     50.0%     |    100.0%    | 50.0% |
+| Total                                   |     50.0%     |    100.0%    | 50.0% |
++-----------------------------------------+---------------+--------------+-------+
+`,
+		},
+		{
+			newCovFile:  "new.cov",
+			baseCovFile: "base.cov",
+			newProfile: "mode: atomic\n" +
+				"qiniu.com/kodo/apiserver/server/main.go:32.49,33.13 1 30\n" +
+				"qiniu.com/kodo/apiserver/server/main.go:42.49,43.13 1 1\n",
+			baseProfile: "mode: atomic\n" +
+				"qiniu.com/kodo/apiserver/server/main.go:32.49,33.13 1 30\n" +
+				"qiniu.com/kodo/apiserver/server/main.go:42.49,43.13 1 0\n",
+			flags: map[string]string{"coverage-threshold-percentage": "80", "flag-crossings": "true"},
+			expectOutput: `+-----------------------------------------+---------------+--------------+-------+------------+
+|                  File                   | Base Coverage | New Coverage | Delta | Threshold  |
++-----------------------------------------+---------------+--------------+-------+------------+
+| qiniu.com/kodo/apiserver/server/main.go |     50.0%     |    100.0%    | 50.0% | rose above |
+| Total                                   |     50.0%     |    100.0%    | 50.0% | rose above |
++-----------------------------------------+---------------+--------------+-------+------------+
 `,
 		},
 	}
@@ -99,7 +136,13 @@ func TestDoDiffForLocalProfiles(t *testing.T) {
 
 		diffCmd.Flags().Set("new-profile", fmt.Sprintf("%s/%s", pwd, tc.newCovFile))
 		diffCmd.Flags().Set("base-profile", fmt.Sprintf("%s/%s", pwd, tc.baseCovFile))
+		for k, v := range tc.flags {
+			diffCmd.Flags().Set(k, v)
+		}
 		out := captureStdout(doDiffForLocalProfiles, diffCmd, nil)
+		for k := range tc.flags {
+			diffCmd.Flags().Set(k, diffCmd.Flags().Lookup(k).DefValue)
+		}
 		assert.Equal(t, out, tc.expectOutput)
 	}
 
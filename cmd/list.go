@@ -22,7 +22,6 @@ import (
 
 	log "github.com/sirupsen/logrus"
 
-	"github.com/qiniu/goc/pkg/cover"
 	"github.com/spf13/cobra"
 )
 
@@ -34,7 +33,7 @@ var listCmd = &cobra.Command{
 goc list [flags]
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		res, err := cover.NewWorker(center).ListServices()
+		res, err := centerWorker().ListServices()
 		if err != nil {
 			log.Fatalf("list failed, err: %v", err)
 		}
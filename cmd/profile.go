@@ -59,7 +59,7 @@ goc profile --force
 			CoverFilePatterns: coverFilePatterns,
 			SkipFilePatterns:  skipFilePatterns,
 		}
-		res, err := cover.NewWorker(center).Profile(p)
+		res, err := centerWorker().Profile(p)
 		if err != nil {
 			log.Fatalf("Goc server %v return an error: %v", center, err)
 		}
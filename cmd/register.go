@@ -38,7 +38,7 @@ goc register [flags]
 			Address:  address,
 			IPRevise: ipRevise,
 		}
-		res, err := cover.NewWorker(center).RegisterService(s)
+		res, err := centerWorker().RegisterService(s)
 		if err != nil {
 			log.Fatalf("register service failed, err: %v", err)
 		}
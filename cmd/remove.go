@@ -42,7 +42,7 @@ goc remove --address="http://127.0.0.1:53" --center=http://192.168.1.1:8080
 			Service: svrList,
 			Address: addrList,
 		}
-		res, err := cover.NewWorker(center).Remove(p)
+		res, err := centerWorker().Remove(p)
 		if err != nil {
 			log.Fatalf("call host %v failed, err: %v, response: %v", center, err, string(res))
 		}
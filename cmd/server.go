@@ -43,7 +43,7 @@ goc server --port=localhost:8080
 			log.Fatalf("New file based server failed, err: %v", err)
 		}
 		server.IPRevise = IPRevise
-		server.Run(port)
+		log.Fatal(server.Run(port))
 	},
 }
 
@@ -7,6 +7,7 @@ require (
 	github.com/google/go-github v17.0.0+incompatible
 	github.com/hashicorp/go-retryablehttp v0.7.2
 	github.com/julienschmidt/httprouter v1.2.0
+	github.com/klauspost/compress v1.16.5
 	github.com/olekukonko/tablewriter v0.0.4
 	github.com/qiniu/api.v7/v7 v7.5.0
 	github.com/sirupsen/logrus v1.9.0
@@ -19,6 +20,7 @@ require (
 	golang.org/x/net v0.17.0
 	golang.org/x/oauth2 v0.8.0
 	golang.org/x/tools v0.13.0
+	gopkg.in/yaml.v2 v2.4.0
 	k8s.io/test-infra v0.0.0-20231102202303-d635123c32b5
 )
 
@@ -65,6 +67,5 @@ require (
 	google.golang.org/appengine v1.6.7 // indirect
 	google.golang.org/protobuf v1.30.0 // indirect
 	gopkg.in/ini.v1 v1.62.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,328 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SuggestTargets returns the files which, if brought to 100%, raise the total ratio
+// of list to target most efficiently. Files are picked greedily by their number of
+// uncovered statements until the target would be met.
+func SuggestTargets(list *CoverageList, target float32) []Coverage {
+	if list == nil {
+		return nil
+	}
+	var covered, all int
+	var candidates []Coverage
+	for _, c := range *list {
+		covered += c.NCoveredStmts
+		all += c.NAllStmts
+		if c.NAllStmts > c.NCoveredStmts {
+			candidates = append(candidates, c)
+		}
+	}
+	if all == 0 {
+		return nil
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].NAllStmts-candidates[i].NCoveredStmts > candidates[j].NAllStmts-candidates[j].NCoveredStmts
+	})
+
+	var res []Coverage
+	for _, c := range candidates {
+		if float32(covered)/float32(all) >= target {
+			break
+		}
+		res = append(res, c)
+		covered += c.NAllStmts - c.NCoveredStmts
+	}
+	return res
+}
+
+// ZeroCoveragePackages returns the packages which have statements but none of them covered,
+// it usually means the tests of the package never ran
+func (g CoverageList) ZeroCoveragePackages() []string {
+	var pkgs []string
+	for _, p := range g.GroupByPackage() {
+		if p.NCoveredStmts == 0 && p.NAllStmts > 0 {
+			pkgs = append(pkgs, p.FileName)
+		}
+	}
+	return pkgs
+}
+
+// MinPackageRatio returns the package with the lowest ratio and its ratio, the floor of the
+// list which the overall ratio of a few well tested packages can mask. The packages without
+// statements are skipped, ties go to the first name, and an empty pkg means no package.
+func (g CoverageList) MinPackageRatio() (pkg string, ratio float32) {
+	found := false
+	for _, p := range g.GroupByPackage() {
+		r, err := p.Ratio()
+		if err != nil {
+			continue
+		}
+		if !found || r < ratio || (r == ratio && p.FileName < pkg) {
+			pkg, ratio, found = p.FileName, r, true
+		}
+	}
+	return pkg, ratio
+}
+
+// BelowThreshold returns the files whose ratio is below threshold in the order of the list,
+// the files without statements are skipped. FirstBelowThreshold is the fail fast variant.
+func (g CoverageList) BelowThreshold(threshold float32) []Coverage {
+	var files []Coverage
+	for i := range g {
+		if g[i].belowThreshold(threshold) {
+			files = append(files, g[i])
+		}
+	}
+	return files
+}
+
+// FirstBelowThreshold returns the first file whose ratio is below threshold and true, or false
+// if there is none. It stops at that file, e.g. for a gate which does not report the failures.
+func (g CoverageList) FirstBelowThreshold(threshold float32) (Coverage, bool) {
+	for i := range g {
+		if g[i].belowThreshold(threshold) {
+			return g[i], true
+		}
+	}
+	return Coverage{}, false
+}
+
+// CountAtOrAbove returns how many files have a ratio at or above threshold out of the files
+// with statements, e.g. "142 of 180 files are above 80%"
+func (g CoverageList) CountAtOrAbove(threshold float32) (meeting, total int) {
+	for i := range g {
+		ratio, err := g[i].Ratio()
+		if err != nil {
+			continue
+		}
+		total++
+		if ratio >= threshold {
+			meeting++
+		}
+	}
+	return meeting, total
+}
+
+func (c *Coverage) belowThreshold(threshold float32) bool {
+	ratio, err := c.Ratio()
+	return err == nil && ratio < threshold
+}
+
+// ZeroCoveredFiles returns the files which have statements but none of them covered, the
+// largest first, then by name. Unlike partial gaps they often tell a whole module is untested.
+func (g CoverageList) ZeroCoveredFiles() []Coverage {
+	var files []Coverage
+	for _, c := range g {
+		if c.NCoveredStmts == 0 && c.NAllStmts > 0 {
+			files = append(files, c)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].NAllStmts != files[j].NAllStmts {
+			return files[i].NAllStmts > files[j].NAllStmts
+		}
+		return files[i].Name() < files[j].Name()
+	})
+	return files
+}
+
+// ErrUnknownFiles is wrapped by the error of CoverageOf when some files are not in the list
+var ErrUnknownFiles = errors.New("files not found in coverage list")
+
+// CoverageOf sums the statements of the given files into one Coverage.
+// If some files are not in the list, the Coverage of the known ones is still returned
+// along with an error wrapping ErrUnknownFiles, so the caller can choose to ignore it.
+func (g CoverageList) CoverageOf(files []string) (*Coverage, error) {
+	m := g.Map()
+	res := &Coverage{}
+	var unknown []string
+	for _, file := range files {
+		c, ok := m[file]
+		if !ok {
+			unknown = append(unknown, file)
+			continue
+		}
+		res.NCoveredStmts += c.NCoveredStmts
+		res.NAllStmts += c.NAllStmts
+	}
+	if len(unknown) > 0 {
+		return res, fmt.Errorf("%w: [%s]", ErrUnknownFiles, strings.Join(unknown, ", "))
+	}
+	return res, nil
+}
+
+// ErrUnmatchedPatterns is wrapped by the error of CoverageOfPackages when some patterns match no package
+var ErrUnmatchedPatterns = errors.New("patterns match no package in coverage list")
+
+// CoverageOfPackages sums the statements of the files whose package matches any of the
+// patterns into one Coverage. A pattern is an import path with the "..." wildcard of the
+// go commands, e.g. "qiniu.com/kodo/apiserver/..." matches apiserver and its subpackages.
+// Like CoverageOf, the Coverage is still returned along with an error wrapping
+// ErrUnmatchedPatterns if some patterns match nothing.
+func (g CoverageList) CoverageOfPackages(patterns []string) (*Coverage, error) {
+	matchers := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		matchers[i] = packagePatternRegexp(pattern)
+	}
+	matched := make([]bool, len(patterns))
+	res := &Coverage{}
+	for _, c := range g {
+		pkg := path.Dir(filepath.ToSlash(c.Name()))
+		found := false
+		for i, m := range matchers {
+			if m.MatchString(pkg) {
+				matched[i], found = true, true
+			}
+		}
+		if found {
+			res.NCoveredStmts += c.NCoveredStmts
+			res.NAllStmts += c.NAllStmts
+		}
+	}
+	var unmatched []string
+	for i, ok := range matched {
+		if !ok {
+			unmatched = append(unmatched, patterns[i])
+		}
+	}
+	if len(unmatched) > 0 {
+		return res, fmt.Errorf("%w: [%s]", ErrUnmatchedPatterns, strings.Join(unmatched, ", "))
+	}
+	return res, nil
+}
+
+// packagePatternRegexp converts a package pattern like the go commands do, a trailing
+// "/..." also matches the package itself
+func packagePatternRegexp(pattern string) *regexp.Regexp {
+	re := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\.\.\.`, `.*`)
+	if strings.HasSuffix(re, `/.*`) {
+		re = strings.TrimSuffix(re, `/.*`) + `(/.*)?`
+	}
+	return regexp.MustCompile(`^` + re + `$`)
+}
+
+// WeightedOverall returns the statement coverage of the list with every file weighted,
+// i.e. sum(weight*covered) / sum(weight*all). Files without an explicit weight use
+// defaultWeight. It returns 0 when there is no weighted statement.
+func (g CoverageList) WeightedOverall(weights map[string]float32, defaultWeight float32) float32 {
+	var covered, all float64
+	for _, c := range g {
+		w, ok := weights[c.FileName]
+		if !ok {
+			w = defaultWeight
+		}
+		covered += float64(w) * float64(c.NCoveredStmts)
+		all += float64(w) * float64(c.NAllStmts)
+	}
+	if all == 0 {
+		return 0
+	}
+	return float32(covered / all)
+}
+
+// GeometricMeanRatio returns the geometric mean of the ratios of the files with statements,
+// which penalizes low outliers more than the overall ratio: a single 0% file makes it 0.
+// It returns 0 when no file has statements.
+func (g CoverageList) GeometricMeanRatio() float32 {
+	var sum float64
+	n := 0
+	for i := range g {
+		ratio, err := g[i].Ratio()
+		if err != nil {
+			continue
+		}
+		if ratio == 0 {
+			return 0
+		}
+		sum += math.Log(float64(ratio))
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return float32(math.Exp(sum / float64(n)))
+}
+
+// StmtsToTarget returns how many more statements must be covered for the file to reach
+// the target ratio, i.e. ceil(target*NAllStmts) - NCoveredStmts clamped at 0.
+// The file with no statement has no ratio to reach, so an error is returned.
+func (c *Coverage) StmtsToTarget(target float32) (int, error) {
+	if c.NAllStmts == 0 {
+		return 0, fmt.Errorf("[%s] has 0 statement", c.Name())
+	}
+	// tolerate the float32 error of the target, e.g. 0.85*20 is slightly above 17
+	need := int(math.Ceil(float64(target)*float64(c.NAllStmts) - 1e-6))
+	if need <= c.NCoveredStmts {
+		return 0, nil
+	}
+	return need - c.NCoveredStmts, nil
+}
+
+// MarginalCoverage returns the number of statements the profile add covers which are not
+// covered in base, i.e. what the profile alone contributes to it, e.g. to tell whether a
+// test suite pulls its weight. It compares the retained blocks, so base must retain them.
+// A nil base is empty, so that all the covered statements of add are new.
+func MarginalCoverage(base *CoverageList, add io.Reader) (newlyCovered int, err error) {
+	if base == nil {
+		base = &CoverageList{}
+	}
+	covered := make(map[string]map[blockKey]bool)
+	for _, c := range *base {
+		if len(c.Blocks) == 0 && c.NAllStmts > 0 {
+			return 0, fmt.Errorf("[%s] has no retained blocks", c.Name())
+		}
+		for i := range c.Blocks {
+			b := &c.Blocks[i]
+			if covered[b.FileName] == nil {
+				covered[b.FileName] = make(map[blockKey]bool)
+			}
+			covered[b.FileName][keyOf(b)] = covered[b.FileName][keyOf(b)] || b.Count > 0
+		}
+	}
+
+	_, blocks, err := ParseBlocks(add)
+	if err != nil {
+		return 0, err
+	}
+	for i := range blocks {
+		b := &blocks[i]
+		if b.Count == 0 || covered[b.FileName][keyOf(b)] {
+			continue
+		}
+		// count a block repeated in the profile once
+		if covered[b.FileName] == nil {
+			covered[b.FileName] = make(map[blockKey]bool)
+		}
+		covered[b.FileName][keyOf(b)] = true
+		newlyCovered += b.NumStmt
+	}
+	return newlyCovered, nil
+}
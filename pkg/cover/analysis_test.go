@@ -0,0 +1,291 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggestTargets(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 10, NAllStmts: 20},
+		Coverage{FileName: "b", NCoveredStmts: 0, NAllStmts: 40},
+		Coverage{FileName: "c", NCoveredStmts: 30, NAllStmts: 40},
+	}
+	items := []struct {
+		target      float32
+		expectFiles []string
+	}{
+		{target: 0.3, expectFiles: nil},
+		{target: 0.7, expectFiles: []string{"b"}},
+		{target: 0.9, expectFiles: []string{"b", "a"}},
+		{target: 1, expectFiles: []string{"b", "a", "c"}},
+	}
+
+	for _, tc := range items {
+		var files []string
+		for _, c := range SuggestTargets(&list, tc.target) {
+			files = append(files, c.FileName)
+		}
+		assert.Equal(t, tc.expectFiles, files)
+	}
+}
+
+func TestZeroCoveragePackages(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/a/a.go", NCoveredStmts: 0, NAllStmts: 20},
+		Coverage{FileName: "qiniu.com/kodo/a/a1.go", NCoveredStmts: 0, NAllStmts: 10},
+		Coverage{FileName: "qiniu.com/kodo/b/b.go", NCoveredStmts: 1, NAllStmts: 40},
+		Coverage{FileName: "qiniu.com/kodo/b/b1.go", NCoveredStmts: 0, NAllStmts: 40},
+		Coverage{FileName: "qiniu.com/kodo/c/c.go", NCoveredStmts: 0, NAllStmts: 0},
+	}
+	assert.Equal(t, []string{"qiniu.com/kodo/a"}, list.ZeroCoveragePackages())
+}
+
+func TestMinPackageRatio(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/a/a.go", NCoveredStmts: 9, NAllStmts: 10},
+		Coverage{FileName: "qiniu.com/kodo/b/b.go", NCoveredStmts: 1, NAllStmts: 4},
+		Coverage{FileName: "qiniu.com/kodo/b/b1.go", NCoveredStmts: 4, NAllStmts: 4},
+		Coverage{FileName: "qiniu.com/kodo/c/c.go", NCoveredStmts: 5, NAllStmts: 8},
+		Coverage{FileName: "qiniu.com/kodo/d/d.go", NCoveredStmts: 0, NAllStmts: 0},
+	}
+	pkg, ratio := list.MinPackageRatio()
+	assert.Equal(t, "qiniu.com/kodo/b", pkg)
+	assert.Equal(t, float32(0.625), ratio)
+
+	pkg, ratio = CoverageList{Coverage{FileName: "qiniu.com/kodo/d/d.go"}}.MinPackageRatio()
+	assert.Equal(t, "", pkg)
+	assert.Equal(t, float32(0), ratio)
+}
+
+func TestBelowThreshold(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "a.go", NCoveredStmts: 9, NAllStmts: 10},
+		Coverage{FileName: "b.go", NCoveredStmts: 1, NAllStmts: 4},
+		Coverage{FileName: "c.go", NCoveredStmts: 0, NAllStmts: 0},
+		Coverage{FileName: "d.go", NCoveredStmts: 5, NAllStmts: 8},
+	}
+	items := []struct {
+		threshold float32
+		expect    []string
+	}{
+		{threshold: 0.5, expect: []string{"b.go"}},
+		{threshold: 0.9, expect: []string{"b.go", "d.go"}},
+		{threshold: 0.25, expect: nil},
+	}
+	for _, tc := range items {
+		var names []string
+		for _, c := range list.BelowThreshold(tc.threshold) {
+			names = append(names, c.FileName)
+		}
+		assert.Equal(t, tc.expect, names)
+
+		first, ok := list.FirstBelowThreshold(tc.threshold)
+		assert.Equal(t, len(tc.expect) > 0, ok)
+		if ok {
+			assert.Equal(t, tc.expect[0], first.FileName)
+		}
+	}
+}
+
+func TestCountAtOrAbove(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "a.go", NCoveredStmts: 8, NAllStmts: 10},
+		Coverage{FileName: "b.go", NCoveredStmts: 1, NAllStmts: 4},
+		Coverage{FileName: "c.go", NCoveredStmts: 0, NAllStmts: 0},
+		Coverage{FileName: "d.go", NCoveredStmts: 9, NAllStmts: 10},
+	}
+	meeting, total := list.CountAtOrAbove(0.8)
+	assert.Equal(t, 2, meeting)
+	assert.Equal(t, 3, total)
+	meeting, total = list.CountAtOrAbove(1)
+	assert.Equal(t, 0, meeting)
+	assert.Equal(t, 3, total)
+	meeting, total = CoverageList{}.CountAtOrAbove(0.5)
+	assert.Equal(t, 0, meeting+total)
+}
+
+func TestZeroCoveredFiles(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/a/a.go", NCoveredStmts: 0, NAllStmts: 20},
+		Coverage{FileName: "qiniu.com/kodo/a/a1.go", NCoveredStmts: 0, NAllStmts: 10},
+		Coverage{FileName: "qiniu.com/kodo/b/b.go", NCoveredStmts: 1, NAllStmts: 40},
+		Coverage{FileName: "qiniu.com/kodo/b/b1.go", NCoveredStmts: 0, NAllStmts: 40},
+		Coverage{FileName: "qiniu.com/kodo/b/b0.go", NCoveredStmts: 0, NAllStmts: 20},
+		Coverage{FileName: "qiniu.com/kodo/c/c.go", NCoveredStmts: 0, NAllStmts: 0},
+	}
+	var names []string
+	for _, c := range list.ZeroCoveredFiles() {
+		names = append(names, c.FileName)
+	}
+	assert.Equal(t, []string{"qiniu.com/kodo/b/b1.go", "qiniu.com/kodo/a/a.go", "qiniu.com/kodo/b/b0.go", "qiniu.com/kodo/a/a1.go"}, names)
+	assert.Empty(t, CoverageList{}.ZeroCoveredFiles())
+}
+
+func TestCoverageOf(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 10, NAllStmts: 20},
+		Coverage{FileName: "b", NCoveredStmts: 0, NAllStmts: 40},
+		Coverage{FileName: "c", NCoveredStmts: 30, NAllStmts: 40},
+	}
+
+	c, err := list.CoverageOf([]string{"a", "c"})
+	assert.NoError(t, err)
+	assert.Equal(t, 40, c.NCoveredStmts)
+	assert.Equal(t, 60, c.NAllStmts)
+
+	c, err = list.CoverageOf([]string{"a", "d"})
+	assert.True(t, errors.Is(err, ErrUnknownFiles))
+	assert.Contains(t, err.Error(), "d")
+	assert.Equal(t, 10, c.NCoveredStmts)
+	assert.Equal(t, 20, c.NAllStmts)
+}
+
+func TestCoverageOfPackages(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/apiserver/main.go", NCoveredStmts: 1, NAllStmts: 2},
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/svr.go", NCoveredStmts: 3, NAllStmts: 4},
+		Coverage{FileName: "qiniu.com/kodo/apiserver2/a.go", NCoveredStmts: 0, NAllStmts: 8},
+		Coverage{FileName: "qiniu.com/kodo/util/b.go", NCoveredStmts: 5, NAllStmts: 10},
+	}
+	items := []struct {
+		patterns        []string
+		covered, all    int
+		expectUnmatched bool
+	}{
+		{patterns: []string{"qiniu.com/kodo/apiserver/..."}, covered: 4, all: 6},
+		{patterns: []string{"qiniu.com/kodo/apiserver"}, covered: 1, all: 2},
+		// a file matched by several patterns is counted once
+		{patterns: []string{"qiniu.com/kodo/...", "qiniu.com/kodo/util"}, covered: 9, all: 24},
+		{patterns: []string{"qiniu.com/.../server"}, covered: 3, all: 4},
+		{patterns: []string{"qiniu.com/kodo/util/...", "qiniu.com/kodo/none/..."}, covered: 5, all: 10, expectUnmatched: true},
+	}
+	for _, tc := range items {
+		c, err := list.CoverageOfPackages(tc.patterns)
+		assert.Equal(t, tc.covered, c.NCoveredStmts, tc.patterns)
+		assert.Equal(t, tc.all, c.NAllStmts, tc.patterns)
+		if tc.expectUnmatched {
+			assert.True(t, errors.Is(err, ErrUnmatchedPatterns))
+			assert.Contains(t, err.Error(), "qiniu.com/kodo/none/...")
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestWeightedOverall(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "critical", NCoveredStmts: 10, NAllStmts: 20},
+		Coverage{FileName: "log", NCoveredStmts: 0, NAllStmts: 20},
+	}
+	items := []struct {
+		weights       map[string]float32
+		defaultWeight float32
+		expect        float32
+	}{
+		{weights: nil, defaultWeight: 1, expect: 0.25},
+		{weights: map[string]float32{"critical": 3}, defaultWeight: 1, expect: 0.375},
+		{weights: map[string]float32{"critical": 1}, defaultWeight: 0, expect: 0.5},
+		{weights: nil, defaultWeight: 0, expect: 0},
+	}
+	for _, tc := range items {
+		assert.InDelta(t, tc.expect, list.WeightedOverall(tc.weights, tc.defaultWeight), 1e-6)
+	}
+}
+
+func TestStmtsToTarget(t *testing.T) {
+	items := []struct {
+		c      Coverage
+		target float32
+		expect int
+	}{
+		{c: Coverage{NCoveredStmts: 10, NAllStmts: 20}, target: 0.85, expect: 7},
+		{c: Coverage{NCoveredStmts: 10, NAllStmts: 21}, target: 0.85, expect: 8},
+		{c: Coverage{NCoveredStmts: 18, NAllStmts: 20}, target: 0.85, expect: 0},
+		{c: Coverage{NCoveredStmts: 0, NAllStmts: 3}, target: 1, expect: 3},
+		{c: Coverage{NCoveredStmts: 0, NAllStmts: 3}, target: 0, expect: 0},
+	}
+	for _, tc := range items {
+		n, err := tc.c.StmtsToTarget(tc.target)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, n)
+	}
+
+	_, err := (&Coverage{FileName: "a"}).StmtsToTarget(0.85)
+	assert.Error(t, err)
+}
+
+func TestGeometricMeanRatio(t *testing.T) {
+	items := []struct {
+		list   CoverageList
+		expect float32
+	}{
+		{list: nil, expect: 0},
+		{list: CoverageList{Coverage{FileName: "a"}}, expect: 0},
+		{list: CoverageList{
+			Coverage{FileName: "a", NCoveredStmts: 1, NAllStmts: 4},
+			Coverage{FileName: "b", NCoveredStmts: 100, NAllStmts: 100},
+			Coverage{FileName: "c"},
+		}, expect: 0.5},
+		{list: CoverageList{
+			Coverage{FileName: "a", NCoveredStmts: 0, NAllStmts: 1},
+			Coverage{FileName: "b", NCoveredStmts: 100, NAllStmts: 100},
+		}, expect: 0},
+	}
+	for _, tc := range items {
+		assert.InDelta(t, tc.expect, tc.list.GeometricMeanRatio(), 1e-6)
+	}
+}
+
+func TestMarginalCoverage(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	base := CoverageList{{FileName: fileName, NCoveredStmts: 1, NAllStmts: 3, Blocks: []CoverBlock{
+		{FileName: fileName, StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 1, NumStmt: 1, Count: 3},
+		{FileName: fileName, StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 1, NumStmt: 2},
+	}}}
+	items := []struct {
+		profile string
+		expect  int
+	}{
+		// covers only what base covers
+		{profile: "mode: count\n" + fileName + ":1.1,2.1 1 5\n" + fileName + ":3.1,4.1 2 0\n", expect: 0},
+		{profile: "mode: count\n" + fileName + ":1.1,2.1 1 0\n" + fileName + ":3.1,4.1 2 1\n", expect: 2},
+		// a file unknown to base, with a repeated block
+		{profile: "mode: count\nother.go:1.1,2.1 4 1\nother.go:1.1,2.1 4 1\n", expect: 4},
+	}
+	for _, tc := range items {
+		n, err := MarginalCoverage(&base, strings.NewReader(tc.profile))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, n, tc.profile)
+	}
+
+	_, err := MarginalCoverage(&base, strings.NewReader(fileName+":1.1,2.1 1 0\n"))
+	assert.Error(t, err)
+	noBlocks := CoverageList{{FileName: fileName, NCoveredStmts: 1, NAllStmts: 3}}
+	_, err = MarginalCoverage(&noBlocks, strings.NewReader("mode: count\n"))
+	assert.Error(t, err)
+
+	n, err := MarginalCoverage(nil, strings.NewReader("mode: count\n"+
+		fileName+":1.1,2.1 2 1\n"+fileName+":1.1,2.1 2 3\n"+fileName+":3.1,4.1 1 0\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
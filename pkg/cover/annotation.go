@@ -0,0 +1,116 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// statusDescriptionLimit is the max length of the description of a GitHub commit status
+const statusDescriptionLimit = 140
+
+// DiffSummaryLine returns the description of a commit status like "coverage 82.3% (-0.4%)",
+// the total coverage of newList and its delta against baseList, or "coverage 82.3% (new)"
+// if there is no base, or "coverage N/A" if there is no newList. It is cut to the length
+// limit of GitHub, e.g. for a custom percentage formatter.
+func DiffSummaryLine(newList, baseList *CoverageList) string {
+	var line string
+	switch {
+	case newList == nil:
+		line = "coverage N/A"
+	case baseList == nil || len(*baseList) == 0:
+		line = fmt.Sprintf("coverage %s (new)", newList.TotalPercentage())
+	default:
+		line = fmt.Sprintf("coverage %s (%+.1f%%)", newList.TotalPercentage(), deltaPercent(TotalDelta(*newList, *baseList)))
+	}
+	if utf8.RuneCountInString(line) > statusDescriptionLimit {
+		line = string([]rune(line)[:statusDescriptionLimit])
+	}
+	return line
+}
+
+// deltaPercent returns the ratio delta in percent rounded to one decimal, to be printed
+// with "%+.1f%%" without a "-0.0%"
+func deltaPercent(delta float32) float64 {
+	return roundPercent(delta, 1)
+}
+
+// roundPercent returns the ratio delta in percent rounded to the given decimals, a delta
+// rounding to zero is a positive zero so it does not print as "-0.0%"
+func roundPercent(delta float32, precision int) float64 {
+	scale := math.Pow10(precision)
+	d := math.Round(float64(delta)*100*scale) / scale
+	if d == 0 {
+		return 0
+	}
+	return d
+}
+
+// WriteGitHubAnnotations writes a GitHub Actions workflow command per file of newList
+// with a coverage issue, which GitHub renders as a file-level annotation of the PR:
+// an ::error:: if the file is below threshold, or a ::warning:: if it regressed against
+// baseList. modulePath is stripped from the file names of the module so that they are
+// relative to the repo root, the other file names and an empty modulePath keep them.
+func WriteGitHubAnnotations(w io.Writer, newList, baseList CoverageList, threshold float32, modulePath string) error {
+	sorted := append(CoverageList(nil), newList...)
+	sorted.Sort()
+	baseMap := baseList.Map()
+
+	bw := bufio.NewWriter(w)
+	for _, n := range sorted {
+		ratio, err := n.Ratio()
+		if err != nil {
+			continue
+		}
+		var reasons []string
+		level := "warning"
+		if ratio < threshold {
+			level = "error"
+			reasons = append(reasons, fmt.Sprintf("coverage %s is below threshold %s", PercentStr(ratio), PercentStr(threshold)))
+		}
+		if b, ok := baseMap[n.Name()]; ok {
+			if baseRatio, err := b.Ratio(); err == nil && ratio < baseRatio {
+				reasons = append(reasons, fmt.Sprintf("coverage dropped from %s to %s", PercentStr(baseRatio), PercentStr(ratio)))
+			}
+		}
+		if len(reasons) == 0 {
+			continue
+		}
+		file := n.Name()
+		if modulePath != "" {
+			file = strings.TrimPrefix(file, modulePath+"/")
+		}
+		fmt.Fprintf(bw, "::%s file=%s,title=%s::%s\n", level,
+			escapeAnnotationProperty(file), escapeAnnotationProperty("Coverage"), escapeAnnotationData(strings.Join(reasons, ", ")))
+	}
+	return bw.Flush()
+}
+
+// escapeAnnotationData escapes the message of a workflow command
+func escapeAnnotationData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeAnnotationProperty escapes a property value of a workflow command
+func escapeAnnotationProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,80 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteGitHubAnnotations(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "github.com/qiniu/goc/pkg/b.go", NCoveredStmts: 3, NAllStmts: 4},
+		Coverage{FileName: "github.com/qiniu/goc/pkg/a.go", NCoveredStmts: 1, NAllStmts: 4},
+		Coverage{FileName: "github.com/qiniu/goc/pkg/c.go", NCoveredStmts: 4, NAllStmts: 4},
+		Coverage{FileName: "github.com/qiniu/goc/pkg/d,1.go", NCoveredStmts: 0, NAllStmts: 4},
+		Coverage{FileName: "github.com/qiniu/goc/pkg/empty.go"},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "github.com/qiniu/goc/pkg/a.go", NCoveredStmts: 2, NAllStmts: 4},
+		Coverage{FileName: "github.com/qiniu/goc/pkg/b.go", NCoveredStmts: 4, NAllStmts: 4},
+		Coverage{FileName: "github.com/qiniu/goc/pkg/c.go", NCoveredStmts: 3, NAllStmts: 4},
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, WriteGitHubAnnotations(&buf, newList, baseList, 0.5, "github.com/qiniu/goc"))
+	assert.Equal(t, "::error file=pkg/a.go,title=Coverage::coverage 25.0%25 is below threshold 50.0%25, coverage dropped from 50.0%25 to 25.0%25\n"+
+		"::warning file=pkg/b.go,title=Coverage::coverage dropped from 100.0%25 to 75.0%25\n"+
+		"::error file=pkg/d%2C1.go,title=Coverage::coverage 0.0%25 is below threshold 50.0%25\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, WriteGitHubAnnotations(&buf, newList[2:3], nil, 0.5, ""))
+	assert.Empty(t, buf.String())
+
+	// a sibling module sharing the prefix keeps its name
+	buf.Reset()
+	assert.NoError(t, WriteGitHubAnnotations(&buf, CoverageList{
+		Coverage{FileName: "github.com/qiniu/gocx/x.go", NCoveredStmts: 0, NAllStmts: 4},
+	}, nil, 0.5, "github.com/qiniu/goc"))
+	assert.Equal(t, "::error file=github.com/qiniu/gocx/x.go,title=Coverage::coverage 0.0%25 is below threshold 50.0%25\n", buf.String())
+}
+
+func TestDiffSummaryLine(t *testing.T) {
+	newList := CoverageList{{FileName: "a.go", NCoveredStmts: 823, NAllStmts: 1000}}
+	items := []struct {
+		base   *CoverageList
+		expect string
+	}{
+		{base: &CoverageList{{FileName: "a.go", NCoveredStmts: 827, NAllStmts: 1000}}, expect: "coverage 82.3% (-0.4%)"},
+		{base: &CoverageList{{FileName: "a.go", NCoveredStmts: 800, NAllStmts: 1000}}, expect: "coverage 82.3% (+2.3%)"},
+		{base: &CoverageList{{FileName: "a.go", NCoveredStmts: 8232, NAllStmts: 10000}}, expect: "coverage 82.3% (+0.0%)"},
+		{base: &CoverageList{}, expect: "coverage 82.3% (new)"},
+		{base: nil, expect: "coverage 82.3% (new)"},
+	}
+	for _, tc := range items {
+		assert.Equal(t, tc.expect, DiffSummaryLine(&newList, tc.base))
+	}
+	assert.Equal(t, "coverage N/A", DiffSummaryLine(nil, &newList))
+	assert.Equal(t, "coverage N/A", DiffSummaryLine(nil, nil))
+
+	defer SetPercentageFormatter(nil)
+	SetPercentageFormatter(func(float32, bool) string { return strings.Repeat("x", 200) })
+	assert.Equal(t, statusDescriptionLimit, len(DiffSummaryLine(&newList, nil)))
+}
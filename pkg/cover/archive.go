@@ -0,0 +1,145 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrUnknownProfileFormat represents the error that a profile is neither text nor of a
+// known compression
+var ErrUnknownProfileFormat = errors.New("unknown profile format")
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// sniffLen is the number of leading bytes a plain profile is told by
+const sniffLen = 512
+
+// OpenProfile returns a reader of the profile text of r, which is decompressed if its magic
+// bytes tell gzip or zstd. A content of neither which does not look like text either, e.g.
+// of another compression, is rejected with an error wrapping ErrUnknownProfileFormat.
+// The returned reader must be closed to release the decompressor.
+func OpenProfile(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	rc, compressed, err := decompress(br)
+	if err != nil || compressed {
+		return rc, err
+	}
+	head, err := br.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !isText(head) {
+		if len(head) > len(zstdMagic) {
+			head = head[:len(zstdMagic)]
+		}
+		return nil, fmt.Errorf("%w: neither text, gzip nor zstd, starts with % x", ErrUnknownProfileFormat, head)
+	}
+	return rc, nil
+}
+
+// decompress sniffs the magic bytes of r and returns a reader of its decompressed content
+// and true, or of r as is and false if it is not compressed by gzip or zstd
+func decompress(r io.Reader) (io.ReadCloser, bool, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, false, fmt.Errorf("open gzip stream failed: %v", err)
+		}
+		return gr, true, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, false, fmt.Errorf("open zstd stream failed: %v", err)
+		}
+		return zr.IOReadCloser(), true, nil
+	}
+	return ioutil.NopCloser(br), false, nil
+}
+
+// isText reports whether the leading bytes of a content are UTF-8 without control
+// characters other than spaces, a rune cut at the end is tolerated
+func isText(head []byte) bool {
+	for i := 0; i < len(head); {
+		r, size := utf8.DecodeRune(head[i:])
+		if r == utf8.RuneError && size == 1 {
+			return !utf8.FullRune(head[i:])
+		}
+		if (r < 0x20 && r != '\t' && r != '\n' && r != '\r') || r == 0x7f {
+			return false
+		}
+		i += size
+	}
+	return true
+}
+
+// CovListFromTar walks the tar archive (optionally gzip or zstd wrapped) to the entry named
+// entryName and converts it to CoverageList, nothing is extracted to disk
+func CovListFromTar(r io.Reader, entryName string) (*CoverageList, error) {
+	rc, _, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	tr := tar.NewReader(rc)
+
+	want := path.Clean(entryName)
+	var entries []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read tar archive failed: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if path.Clean(hdr.Name) == want {
+			g, err := CovList(tr)
+			if err != nil {
+				return nil, err
+			}
+			return &g, nil
+		}
+		entries = append(entries, hdr.Name)
+	}
+
+	return nil, fmt.Errorf("entry %s not found in tar archive, available entries: [%s]", entryName, strings.Join(entries, ", "))
+}
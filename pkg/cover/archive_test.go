@@ -0,0 +1,157 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+)
+
+func buildTestTar(t *testing.T, files map[string]string, gz bool) []byte {
+	var buf bytes.Buffer
+	var tw *tar.Writer
+	var gw *gzip.Writer
+	if gz {
+		gw = gzip.NewWriter(&buf)
+		tw = tar.NewWriter(gw)
+	} else {
+		tw = tar.NewWriter(&buf)
+	}
+	for name, content := range files {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		assert.NoError(t, err)
+		_, err = tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tw.Close())
+	if gw != nil {
+		assert.NoError(t, gw.Close())
+	}
+	return buf.Bytes()
+}
+
+func TestCovListFromTar(t *testing.T) {
+	files := map[string]string{
+		"profiles/a.cov": "mode: atomic\n" +
+			"qiniu.com/kodo/apiserver/server/main.go:32.49,33.13 1 30\n" +
+			"qiniu.com/kodo/apiserver/server/main.go:42.49,43.13 1 0\n",
+		"profiles/b.cov": "mode: atomic\n" +
+			"qiniu.com/kodo/apiserver/server/svr.go:32.49,33.13 1 30\n",
+	}
+
+	for _, gz := range []bool{false, true} {
+		data := buildTestTar(t, files, gz)
+
+		g, err := CovListFromTar(bytes.NewReader(data), "profiles/a.cov")
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(*g))
+		assert.Equal(t, "50.0%", (*g)[0].Percentage())
+
+		_, err = CovListFromTar(bytes.NewReader(data), "profiles/c.cov")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "profiles/a.cov")
+		assert.Contains(t, err.Error(), "profiles/b.cov")
+	}
+
+	zw, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	data := zw.EncodeAll(buildTestTar(t, files, false), nil)
+	assert.NoError(t, zw.Close())
+	g, err := CovListFromTar(bytes.NewReader(data), "profiles/b.cov")
+	assert.NoError(t, err)
+	assert.Equal(t, "100.0%", g.TotalPercentage())
+}
+
+func TestOpenProfile(t *testing.T) {
+	profile := "mode: atomic\n" +
+		"qiniu.com/kodo/apiserver/server/main.go:32.49,33.13 1 30\n" +
+		"qiniu.com/kodo/apiserver/server/main.go:42.49,43.13 1 0\n"
+
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	_, err := gw.Write([]byte(profile))
+	assert.NoError(t, err)
+	assert.NoError(t, gw.Close())
+
+	zw, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	zst := zw.EncodeAll([]byte(profile), nil)
+	assert.NoError(t, zw.Close())
+
+	items := []struct {
+		name string
+		data []byte
+	}{
+		{name: "plain", data: []byte(profile)},
+		{name: "bom", data: append([]byte("\xef\xbb\xbf"), profile...)},
+		{name: "gzip", data: gz.Bytes()},
+		{name: "zstd", data: zst},
+	}
+	for _, tc := range items {
+		r, err := OpenProfile(bytes.NewReader(tc.data))
+		if !assert.NoError(t, err, tc.name) {
+			continue
+		}
+		g, err := CovList(r)
+		assert.NoError(t, err, tc.name)
+		assert.NoError(t, r.Close())
+		assert.Equal(t, "50.0%", g.TotalPercentage(), tc.name)
+	}
+
+	r, err := OpenProfile(bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.NoError(t, r.Close())
+
+	// e.g. xz
+	_, err = OpenProfile(bytes.NewReader([]byte("\xfd7zXZ\x00\x00")))
+	assert.True(t, errors.Is(err, ErrUnknownProfileFormat))
+	assert.Contains(t, err.Error(), "fd 37 7a 58")
+
+	_, err = OpenProfile(bytes.NewReader([]byte{0x1f, 0x8b, 0x00}))
+	assert.Error(t, err)
+}
+
+func TestReadCompressedFileToCoverList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-archive-test")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	zw, err := zstd.NewWriter(nil)
+	assert.NoError(t, err)
+	p := filepath.Join(dir, "cover.out.zst")
+	assert.NoError(t, ioutil.WriteFile(p, zw.EncodeAll([]byte("mode: set\na.go:1.1,2.2 1 1\n"), nil), 0644))
+	assert.NoError(t, zw.Close())
+
+	g, err := ReadFileToCoverList(p)
+	assert.NoError(t, err)
+	assert.Equal(t, "100.0%", g.TotalPercentage())
+
+	assert.NoError(t, ioutil.WriteFile(p, []byte{0x00, 0x01, 0x02}, 0644))
+	_, err = ReadFileToCoverList(p)
+	assert.True(t, errors.Is(err, ErrUnknownProfileFormat))
+}
@@ -0,0 +1,162 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// binaryMagic starts the binary encoding of a CoverageList, followed by its version
+const (
+	binaryMagic   = "GOCB"
+	binaryVersion = 1
+)
+
+var errBadBinary = errors.New("bad binary coverage list")
+
+// MarshalBinary implements encoding.BinaryMarshaler with a compact varint encoding of
+// the totals, mode and retained blocks of every file, which is smaller and faster to
+// decode than json, e.g. for caching the lists
+func (g CoverageList) MarshalBinary() ([]byte, error) {
+	buf := append([]byte(binaryMagic), binaryVersion)
+	buf = binary.AppendUvarint(buf, uint64(len(g)))
+	for _, c := range g {
+		buf = appendString(buf, c.FileName)
+		buf = binary.AppendVarint(buf, int64(c.NCoveredStmts))
+		buf = binary.AppendVarint(buf, int64(c.NAllStmts))
+		buf = appendString(buf, c.LineCovLink)
+		buf = appendString(buf, c.Mode)
+		buf = binary.AppendUvarint(buf, uint64(len(c.Blocks)))
+		for _, b := range c.Blocks {
+			// 0 for a block in the file itself, otherwise the length of its file name + 1
+			if b.FileName == c.FileName {
+				buf = binary.AppendUvarint(buf, 0)
+			} else {
+				buf = binary.AppendUvarint(buf, uint64(len(b.FileName))+1)
+				buf = append(buf, b.FileName...)
+			}
+			for _, v := range []int{b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt} {
+				buf = binary.AppendVarint(buf, int64(v))
+			}
+			buf = binary.AppendVarint(buf, b.Count)
+			buf = appendString(buf, b.FuncName)
+		}
+	}
+	return buf, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler for the encoding of MarshalBinary
+func (g *CoverageList) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(binaryMagic)) || len(data) < len(binaryMagic)+1 {
+		return errBadBinary
+	}
+	if v := data[len(binaryMagic)]; v != binaryVersion {
+		return fmt.Errorf("unsupported binary coverage list version %d", v)
+	}
+	d := &binaryDecoder{r: bytes.NewReader(data[len(binaryMagic)+1:])}
+
+	n := d.length()
+	list := make(CoverageList, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		c := Coverage{FileName: d.string()}
+		c.NCoveredStmts = d.int()
+		c.NAllStmts = d.int()
+		c.LineCovLink = d.string()
+		c.Mode = d.string()
+		if nBlocks := d.length(); nBlocks > 0 {
+			c.Blocks = make([]CoverBlock, 0, nBlocks)
+			for j := 0; j < nBlocks && d.err == nil; j++ {
+				b := CoverBlock{FileName: c.FileName}
+				if l := d.length(); l > 0 {
+					b.FileName = d.bytes(l - 1)
+				}
+				b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt = d.int(), d.int(), d.int(), d.int(), d.int()
+				b.Count = d.varint()
+				b.FuncName = d.string()
+				c.Blocks = append(c.Blocks, b)
+			}
+		}
+		list = append(list, c)
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if d.r.Len() != 0 {
+		return errBadBinary
+	}
+	*g = list
+	return nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// binaryDecoder reads the values of the binary encoding, keeping the first error
+type binaryDecoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *binaryDecoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	if err != nil {
+		d.err = errBadBinary
+	}
+	return v
+}
+
+func (d *binaryDecoder) int() int {
+	return int(d.varint())
+}
+
+// length reads a length, which can not exceed the remaining bytes
+func (d *binaryDecoder) length() int {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(d.r)
+	if err != nil || v > uint64(d.r.Len())+1 {
+		d.err = errBadBinary
+		return 0
+	}
+	return int(v)
+}
+
+func (d *binaryDecoder) bytes(n int) string {
+	if d.err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		d.err = errBadBinary
+		return ""
+	}
+	return string(buf)
+}
+
+func (d *binaryDecoder) string() string {
+	return d.bytes(d.length())
+}
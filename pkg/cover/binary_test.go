@@ -0,0 +1,138 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	items := []struct {
+		name string
+		list CoverageList
+	}{
+		{name: "empty", list: CoverageList{}},
+		{name: "totals only", list: CoverageList{{FileName: "a.go", NCoveredStmts: 1, NAllStmts: 2, LineCovLink: "http://a", Mode: "set"}}},
+		{
+			name: "blocks",
+			list: CoverageList{
+				{FileName: "a.go", NCoveredStmts: 1, NAllStmts: 3, Mode: "count", Blocks: []CoverBlock{
+					{FileName: "a.go", StartLine: 1, StartCol: 2, EndLine: 3, EndCol: 4, NumStmt: 1, Count: 1 << 40, FuncName: "F"},
+					{FileName: "a.go", StartLine: 5, StartCol: 1, EndLine: 6, EndCol: 2, NumStmt: 2},
+				}},
+				{FileName: "pkg", NAllStmts: 1, Blocks: []CoverBlock{
+					{FileName: "pkg/b.go", StartLine: 1, EndLine: 1, NumStmt: 1, Count: -1},
+				}},
+			},
+		},
+	}
+
+	for _, tc := range items {
+		data, err := tc.list.MarshalBinary()
+		assert.NoError(t, err, tc.name)
+		var got CoverageList
+		assert.NoError(t, got.UnmarshalBinary(data), tc.name)
+		assert.Equal(t, tc.list, got, tc.name)
+	}
+}
+
+func TestUnmarshalBinaryInvalid(t *testing.T) {
+	data, _ := CoverageList{{FileName: "a.go", NAllStmts: 1, Blocks: []CoverBlock{{FileName: "a.go", NumStmt: 1}}}}.MarshalBinary()
+	items := [][]byte{
+		nil,
+		[]byte("json"),
+		append([]byte(binaryMagic), 9),
+		data[:len(data)-1],
+		append(data, 0),
+	}
+
+	for i, tc := range items {
+		list := CoverageList{{FileName: "keep.go"}}
+		assert.Error(t, list.UnmarshalBinary(tc), "item %d", i)
+		assert.Equal(t, "keep.go", list[0].FileName, "item %d", i)
+	}
+}
+
+// jsonCoverage encodes every field of Coverage, blocks included, for comparison
+type jsonCoverage Coverage
+
+func benchmarkList() CoverageList {
+	list := make(CoverageList, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		name := fmt.Sprintf("github.com/qiniu/goc/pkg/p%d/file%d.go", i/10, i)
+		c := Coverage{FileName: name, NCoveredStmts: 3, NAllStmts: 5, Mode: "count"}
+		for j := 0; j < 5; j++ {
+			c.Blocks = append(c.Blocks, CoverBlock{FileName: name, StartLine: 10 * j, StartCol: 2, EndLine: 10*j + 5, EndCol: 3, NumStmt: 1, Count: int64(j % 2)})
+		}
+		list = append(list, c)
+	}
+	return list
+}
+
+func toJSONList(list CoverageList) []jsonCoverage {
+	out := make([]jsonCoverage, len(list))
+	for i, c := range list {
+		out[i] = jsonCoverage(c)
+	}
+	return out
+}
+
+func BenchmarkMarshalBinary(b *testing.B) {
+	list := benchmarkList()
+	b.ResetTimer()
+	var data []byte
+	for i := 0; i < b.N; i++ {
+		data, _ = list.MarshalBinary()
+	}
+	b.ReportMetric(float64(len(data)), "bytes")
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	list := toJSONList(benchmarkList())
+	b.ResetTimer()
+	var data []byte
+	for i := 0; i < b.N; i++ {
+		data, _ = json.Marshal(list)
+	}
+	b.ReportMetric(float64(len(data)), "bytes")
+}
+
+func BenchmarkUnmarshalBinary(b *testing.B) {
+	data, _ := benchmarkList().MarshalBinary()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var list CoverageList
+		if err := list.UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalJSON(b *testing.B) {
+	data, _ := json.Marshal(toJSONList(benchmarkList()))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var list []jsonCoverage
+		if err := json.Unmarshal(data, &list); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
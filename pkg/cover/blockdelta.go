@@ -0,0 +1,237 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"sort"
+)
+
+// FileDelta holds the blocks of a file which changed between two profiles. Changed
+// blocks carry their new count, a block whose statement count changed is removed and added.
+type FileDelta struct {
+	FileName string       `json:"file"`
+	Added    []CoverBlock `json:"added,omitempty"`
+	Removed  []CoverBlock `json:"removed,omitempty"`
+	Changed  []CoverBlock `json:"changed,omitempty"`
+}
+
+// ProfileDelta is the difference of a profile against a base one, which is smaller to
+// store than the profile when only a few blocks changed, e.g. in a coverage history
+type ProfileDelta struct {
+	Mode  string      `json:"mode"`
+	Files []FileDelta `json:"files"`
+}
+
+// DiffProfiles returns the delta turning base into new, both must retain their blocks
+// and hold every block once, see indexBlocks.
+// ApplyDelta reconstructs new from base and the delta.
+func DiffProfiles(base, new *CoverageList) (*ProfileDelta, error) {
+	baseFiles, err := indexBlocks(base)
+	if err != nil {
+		return nil, err
+	}
+	newFiles, err := indexBlocks(new)
+	if err != nil {
+		return nil, err
+	}
+	mode, err := new.mode()
+	if err != nil {
+		return nil, err
+	}
+
+	delta := &ProfileDelta{Mode: mode}
+	for _, file := range unionKeys(baseFiles, newFiles) {
+		fd := FileDelta{FileName: file}
+		b, n := baseFiles[file], newFiles[file]
+		for _, key := range sortedBlockKeys(n) {
+			old, ok := b[key]
+			switch {
+			case !ok || old.NumStmt != n[key].NumStmt:
+				if ok {
+					fd.Removed = append(fd.Removed, old)
+				}
+				fd.Added = append(fd.Added, n[key])
+			case old.Count != n[key].Count:
+				fd.Changed = append(fd.Changed, n[key])
+			}
+		}
+		for _, key := range sortedBlockKeys(b) {
+			if _, ok := n[key]; !ok {
+				fd.Removed = append(fd.Removed, b[key])
+			}
+		}
+		if len(fd.Added)+len(fd.Removed)+len(fd.Changed) > 0 {
+			delta.Files = append(delta.Files, fd)
+		}
+	}
+	return delta, nil
+}
+
+// ApplyDelta applies the delta of DiffProfiles to base, which must retain its blocks. The
+// result has the files sorted by name and their blocks by position, so it equals the new
+// profile once sorted the same way. It is an error if the delta does not match base.
+func ApplyDelta(base *CoverageList, delta *ProfileDelta) (CoverageList, error) {
+	files, err := indexBlocks(base)
+	if err != nil {
+		return nil, err
+	}
+	for _, fd := range delta.Files {
+		blocks := files[fd.FileName]
+		if blocks == nil {
+			blocks = make(map[blockKey]CoverBlock)
+			files[fd.FileName] = blocks
+		}
+		for i := range fd.Removed {
+			key := keyOf(&fd.Removed[i])
+			if _, ok := blocks[key]; !ok {
+				return nil, fmt.Errorf("removed block %s not in base", blockStr(&fd.Removed[i]))
+			}
+			delete(blocks, key)
+		}
+		for i := range fd.Changed {
+			key := keyOf(&fd.Changed[i])
+			if _, ok := blocks[key]; !ok {
+				return nil, fmt.Errorf("changed block %s not in base", blockStr(&fd.Changed[i]))
+			}
+			blocks[key] = fd.Changed[i]
+		}
+		for i := range fd.Added {
+			key := keyOf(&fd.Added[i])
+			if _, ok := blocks[key]; ok {
+				return nil, fmt.Errorf("added block %s already in base", blockStr(&fd.Added[i]))
+			}
+			blocks[key] = fd.Added[i]
+		}
+	}
+
+	g := NewCoverageList()
+	var names []string
+	for file := range files {
+		names = append(names, file)
+	}
+	sort.Strings(names)
+	for _, file := range names {
+		for _, key := range sortedBlockKeys(files[file]) {
+			blk := files[file][key]
+			blk.addToGroupCov(&g)
+		}
+	}
+	g.setMode(delta.Mode)
+	return g, nil
+}
+
+// CoverageChanges returns the blocks covered in new but not in base, gained, and the ones
+// covered in base but not in new, lost, between two runs of the same build, e.g. to
+// investigate flaky coverage. Both must retain their blocks, and it is an error of source
+// drift if the lists differ in their files or blocks. The blocks are sorted by file and position.
+func CoverageChanges(base, new *CoverageList) (gained, lost []CoverBlock, err error) {
+	baseFiles, err := indexBlocks(base)
+	if err != nil {
+		return nil, nil, err
+	}
+	newFiles, err := indexBlocks(new)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, file := range unionKeys(baseFiles, newFiles) {
+		b, n := baseFiles[file], newFiles[file]
+		if err := checkSameBlocks(file, b, n); err != nil {
+			return nil, nil, err
+		}
+		for _, key := range sortedBlockKeys(n) {
+			switch {
+			case b[key].Count == 0 && n[key].Count > 0:
+				gained = append(gained, n[key])
+			case b[key].Count > 0 && n[key].Count == 0:
+				lost = append(lost, n[key])
+			}
+		}
+	}
+	return gained, lost, nil
+}
+
+// checkSameBlocks reports the source drift of a file between two lists of the same build
+func checkSameBlocks(file string, base, new map[blockKey]CoverBlock) error {
+	if base == nil || new == nil {
+		return fmt.Errorf("source drift: %s is not in both lists", file)
+	}
+	baseStmts, newStmts := 0, 0
+	for key, b := range base {
+		baseStmts += b.NumStmt
+		if n, ok := new[key]; !ok || n.NumStmt != b.NumStmt {
+			return fmt.Errorf("source drift: block %s differs", blockStr(&b))
+		}
+	}
+	for _, n := range new {
+		newStmts += n.NumStmt
+	}
+	if len(base) != len(new) || baseStmts != newStmts {
+		return fmt.Errorf("source drift: %s has %d statements vs %d", file, baseStmts, newStmts)
+	}
+	return nil
+}
+
+// indexBlocks indexes the retained blocks of the list by file and position. A block
+// repeated in the list, e.g. of concatenated profiles, is an error as it would collapse
+// into one, the list must be merged first, see Accumulator.
+func indexBlocks(list *CoverageList) (map[string]map[blockKey]CoverBlock, error) {
+	files := make(map[string]map[blockKey]CoverBlock)
+	for _, c := range *list {
+		if len(c.Blocks) == 0 && c.NAllStmts > 0 {
+			return nil, fmt.Errorf("[%s] has no retained blocks", c.Name())
+		}
+		for i := range c.Blocks {
+			b := &c.Blocks[i]
+			if files[b.FileName] == nil {
+				files[b.FileName] = make(map[blockKey]CoverBlock)
+			}
+			if _, ok := files[b.FileName][keyOf(b)]; ok {
+				return nil, fmt.Errorf("duplicate block %s, merge the profile first", blockStr(b))
+			}
+			files[b.FileName][keyOf(b)] = *b
+		}
+	}
+	return files, nil
+}
+
+func unionKeys(x, y map[string]map[blockKey]CoverBlock) []string {
+	var keys []string
+	for k := range x {
+		keys = append(keys, k)
+	}
+	for k := range y {
+		if _, ok := x[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedBlockKeys(blocks map[blockKey]CoverBlock) []blockKey {
+	keys := make([]blockKey, 0, len(blocks))
+	for k := range blocks {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keyLess(keys[i], keys[j]) })
+	return keys
+}
+
+func blockStr(b *CoverBlock) string {
+	return fmt.Sprintf("%s:%d.%d,%d.%d", b.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol)
+}
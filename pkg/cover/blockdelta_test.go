@@ -0,0 +1,160 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffProfilesRoundTrip(t *testing.T) {
+	base := "mode: count\n" +
+		"a.go:1.1,2.1 1 3\n" +
+		"a.go:3.1,4.1 2 0\n" +
+		"a.go:5.1,6.1 1 1\n" +
+		"b.go:1.1,2.1 1 1\n" +
+		"removed.go:1.1,2.1 4 1\n" +
+		"same.go:1.1,2.1 1 1\n"
+	new := "mode: count\n" +
+		"a.go:1.1,2.1 1 5\n" +
+		"a.go:3.1,4.1 2 0\n" +
+		"a.go:5.1,6.1 2 1\n" +
+		"a.go:7.1,8.1 1 0\n" +
+		"added.go:1.1,2.1 3 2\n" +
+		"b.go:1.1,2.1 1 1\n" +
+		"same.go:1.1,2.1 1 1\n"
+	baseList, err := CovList(strings.NewReader(base))
+	assert.NoError(t, err)
+	newList, err := CovList(strings.NewReader(new))
+	assert.NoError(t, err)
+
+	delta, err := DiffProfiles(&baseList, &newList)
+	assert.NoError(t, err)
+	assert.Equal(t, "count", delta.Mode)
+	var files []string
+	for _, fd := range delta.Files {
+		files = append(files, fd.FileName)
+	}
+	assert.Equal(t, []string{"a.go", "added.go", "removed.go"}, files)
+	a := delta.Files[0]
+	assert.Equal(t, 2, len(a.Added))
+	assert.Equal(t, 1, len(a.Removed))
+	assert.Equal(t, []CoverBlock{{FileName: "a.go", StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 1, NumStmt: 1, Count: 5}}, a.Changed)
+
+	got, err := ApplyDelta(&baseList, delta)
+	assert.NoError(t, err)
+	assert.Equal(t, newList, got)
+
+	// an empty delta between the same profiles
+	delta, err = DiffProfiles(&newList, &newList)
+	assert.NoError(t, err)
+	assert.Empty(t, delta.Files)
+}
+
+func TestApplyDeltaErr(t *testing.T) {
+	baseList, err := CovList(strings.NewReader("mode: set\na.go:1.1,2.1 1 1\n"))
+	assert.NoError(t, err)
+	block := CoverBlock{FileName: "a.go", StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 1, NumStmt: 1}
+	items := []FileDelta{
+		{FileName: "a.go", Removed: []CoverBlock{block}},
+		{FileName: "a.go", Changed: []CoverBlock{block}},
+		{FileName: "a.go", Added: []CoverBlock{baseList[0].Blocks[0]}},
+	}
+	for _, fd := range items {
+		_, err := ApplyDelta(&baseList, &ProfileDelta{Mode: "set", Files: []FileDelta{fd}})
+		assert.Error(t, err)
+	}
+
+	noBlocks := CoverageList{{FileName: "a.go", NCoveredStmts: 1, NAllStmts: 1}}
+	_, err = DiffProfiles(&noBlocks, &baseList)
+	assert.Error(t, err)
+	_, err = ApplyDelta(&noBlocks, &ProfileDelta{})
+	assert.Error(t, err)
+}
+
+func TestDiffProfilesDuplicateBlocks(t *testing.T) {
+	profile := "mode: count\na.go:1.1,2.1 1 1\na.go:1.1,2.1 1 2\n"
+	dup, err := CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, dup[0].NAllStmts)
+	single, err := CovList(strings.NewReader("mode: count\na.go:1.1,2.1 1 1\n"))
+	assert.NoError(t, err)
+
+	_, err = DiffProfiles(&single, &dup)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "duplicate block a.go:1.1,2.1")
+	}
+	_, err = DiffProfiles(&dup, &single)
+	assert.Error(t, err)
+	_, err = ApplyDelta(&dup, &ProfileDelta{Mode: "count"})
+	assert.Error(t, err)
+
+	// merged first, the list round-trips
+	acc := NewAccumulator(MergeSum)
+	assert.NoError(t, acc.Add(strings.NewReader(profile)))
+	merged := acc.List()
+	delta, err := DiffProfiles(&single, &merged)
+	assert.NoError(t, err)
+	res, err := ApplyDelta(&single, delta)
+	assert.NoError(t, err)
+	assert.Equal(t, merged, res)
+}
+
+func TestCoverageChanges(t *testing.T) {
+	base, err := CovList(strings.NewReader("mode: count\n" +
+		"a.go:1.1,2.1 1 3\n" +
+		"a.go:3.1,4.1 2 0\n" +
+		"b.go:1.1,2.1 1 1\n" +
+		"b.go:3.1,4.1 1 1\n"))
+	assert.NoError(t, err)
+	new, err := CovList(strings.NewReader("mode: count\n" +
+		"a.go:1.1,2.1 1 1\n" +
+		"a.go:3.1,4.1 2 5\n" +
+		"b.go:1.1,2.1 1 0\n" +
+		"b.go:3.1,4.1 1 2\n"))
+	assert.NoError(t, err)
+
+	gained, lost, err := CoverageChanges(&base, &new)
+	assert.NoError(t, err)
+	assert.Equal(t, []CoverBlock{{FileName: "a.go", StartLine: 3, StartCol: 1, EndLine: 4, EndCol: 1, NumStmt: 2, Count: 5}}, gained)
+	assert.Equal(t, []CoverBlock{{FileName: "b.go", StartLine: 1, StartCol: 1, EndLine: 2, EndCol: 1, NumStmt: 1, Count: 0}}, lost)
+
+	gained, lost, err = CoverageChanges(&base, &base)
+	assert.NoError(t, err)
+	assert.Empty(t, gained)
+	assert.Empty(t, lost)
+
+	drifts := []string{
+		// a missing file
+		"mode: count\na.go:1.1,2.1 1 3\na.go:3.1,4.1 2 0\n",
+		// a moved block
+		"mode: count\na.go:1.1,2.1 1 3\na.go:3.1,5.1 2 0\nb.go:1.1,2.1 1 1\nb.go:3.1,4.1 1 1\n",
+		// a changed statement count
+		"mode: count\na.go:1.1,2.1 1 3\na.go:3.1,4.1 3 0\nb.go:1.1,2.1 1 1\nb.go:3.1,4.1 1 1\n",
+		// an added block
+		"mode: count\na.go:1.1,2.1 1 3\na.go:3.1,4.1 2 0\na.go:5.1,6.1 1 0\nb.go:1.1,2.1 1 1\nb.go:3.1,4.1 1 1\n",
+	}
+	for _, profile := range drifts {
+		drifted, err := CovList(strings.NewReader(profile))
+		assert.NoError(t, err)
+		_, _, err = CoverageChanges(&base, &drifted)
+		assert.Error(t, err, profile)
+		assert.Contains(t, err.Error(), "source drift")
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// CoverageCache stores the coverage parsed from profiles, keyed by the hash of the raw
+// profile bytes. It can be backed by memory or disk, a cache which fails to store
+// an entry may simply drop it.
+type CoverageCache interface {
+	Get(key string) (CoverageList, bool)
+	Put(key string, list CoverageList)
+}
+
+// MemoryCache is a CoverageCache kept in memory, it is safe for concurrent use
+type MemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]CoverageList
+}
+
+// NewMemoryCache creates an empty MemoryCache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{entries: make(map[string]CoverageList)}
+}
+
+// Get returns the cached coverage of the key
+func (c *MemoryCache) Get(key string) (CoverageList, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	list, ok := c.entries[key]
+	return list, ok
+}
+
+// Put caches the coverage of the key
+func (c *MemoryCache) Put(key string, list CoverageList) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = list
+}
+
+// contentKey is the cache key of the raw profile bytes
+func contentKey(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// CovListFromDir merges the profiles in dir, which are the regular files not starting
+// with a dot, summing the hit counts of the same block. The profiles whose content
+// is found in cache are not parsed again, the cache may be nil.
+func CovListFromDir(dir string, cache CoverageCache) (CoverageList, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+
+	a := NewAccumulator(MergeSum)
+	for _, info := range infos {
+		if !info.Mode().IsRegular() || strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		name := filepath.Join(dir, info.Name())
+		content, err := ioutil.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+
+		key := contentKey(content)
+		list, ok := CoverageList(nil), false
+		if cache != nil {
+			list, ok = cache.Get(key)
+		}
+		if !ok {
+			list, err = CovList(bytes.NewReader(content))
+			if err != nil {
+				return nil, fmt.Errorf("parse profile %s: %v", name, err)
+			}
+			if cache != nil {
+				cache.Put(key, list)
+			}
+		}
+		if err := a.addList(list); err != nil {
+			return nil, fmt.Errorf("merge profile %s: %v", name, err)
+		}
+	}
+	return a.List(), nil
+}
+
+// addList merges the blocks of the parsed coverage, which is left untouched
+func (a *Accumulator) addList(list CoverageList) error {
+	if len(list) == 0 {
+		return nil
+	}
+	mode := list[0].Mode
+	if a.mode != "" && a.mode != mode {
+		return fmt.Errorf("mode mismatch: %s vs %s", a.mode, mode)
+	}
+	a.mode = mode
+	if a.resolver != nil {
+		var blocks []CoverBlock
+		for i := range list {
+			blocks = append(blocks, list[i].Blocks...)
+		}
+		return a.resolveBlocks(blocks)
+	}
+	for i := range list {
+		for j := range list[i].Blocks {
+			if err := a.addBlock(&list[i].Blocks[j]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
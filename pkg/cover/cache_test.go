@@ -0,0 +1,87 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// countingCache records the cache hits and misses of a MemoryCache
+type countingCache struct {
+	*MemoryCache
+	hits, misses int
+}
+
+func (c *countingCache) Get(key string) (CoverageList, bool) {
+	list, ok := c.MemoryCache.Get(key)
+	if ok {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return list, ok
+}
+
+func TestCovListFromDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-cache-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	write := func(name, content string) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	write("a.cov", "mode: count\n"+fileName+":32.49,33.13 1 30\n"+fileName+":42.49,43.13 1 0\n")
+	write("b.cov", "mode: count\n"+fileName+":32.49,33.13 1 2\n"+fileName+":42.49,43.13 1 0\n")
+	write(".hidden", "not a profile")
+
+	cache := &countingCache{MemoryCache: NewMemoryCache()}
+	c, err := CovListFromDir(dir, cache)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(c))
+	assert.Equal(t, "50.0%", c[0].Percentage())
+	assert.Equal(t, int64(32), c[0].Blocks[0].Count)
+	assert.Equal(t, 0, cache.hits)
+	assert.Equal(t, 2, cache.misses)
+
+	// the cached coverage is not modified by merging
+	c, err = CovListFromDir(dir, cache)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(32), c[0].Blocks[0].Count)
+	assert.Equal(t, 2, cache.hits)
+	assert.Equal(t, 2, cache.misses)
+
+	write("b.cov", "mode: count\n"+fileName+":32.49,33.13 1 2\n"+fileName+":42.49,43.13 1 1\n")
+	c, err = CovListFromDir(dir, cache)
+	assert.NoError(t, err)
+	assert.Equal(t, "100.0%", c[0].Percentage())
+	assert.Equal(t, 3, cache.hits)
+	assert.Equal(t, 3, cache.misses)
+
+	uncached, err := CovListFromDir(dir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, c, uncached)
+
+	write("c.cov", "mode: set\n"+fileName+":32.49,33.13 1 1\n")
+	_, err = CovListFromDir(dir, cache)
+	assert.Error(t, err)
+}
@@ -26,8 +26,6 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
-
-	log "github.com/sirupsen/logrus"
 )
 
 // Action provides methods to contact with the covered service under test
@@ -61,15 +59,15 @@ type client struct {
 }
 
 // NewWorker creates a worker to contact with service
-func NewWorker(host string) Action {
+func NewWorker(host string) (Action, error) {
 	_, err := url.ParseRequestURI(host)
 	if err != nil {
-		log.Fatalf("Parse url %s failed, err: %v", host, err)
+		return nil, fmt.Errorf("parse url %s failed, err: %v", host, err)
 	}
 	return &client{
 		Host:   host,
 		client: http.DefaultClient,
-	}
+	}, nil
 }
 
 func (c *client) RegisterService(srv ServiceUnderTest) ([]byte, error) {
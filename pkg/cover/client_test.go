@@ -33,7 +33,8 @@ func TestClientAction(t *testing.T) {
 	assert.NoError(t, err)
 	ts := httptest.NewServer(server.Route(os.Stdout))
 	defer ts.Close()
-	var client = NewWorker(ts.URL)
+	client, err := NewWorker(ts.URL)
+	assert.NoError(t, err)
 
 	// mock profile server
 	profileMockResponse := []byte("mode: count\nmockService/main.go:30.13,48.33 13 1\nb/b.go:30.13,48.33 13 1")
@@ -202,6 +203,11 @@ func TestClientListServices(t *testing.T) {
 	assert.Contains(t, err.Error(), "connect: connection refused")
 }
 
+func TestNewWorkerWithInvalidHost(t *testing.T) {
+	_, err := NewWorker("not a url")
+	assert.Error(t, err)
+}
+
 func TestClientDo(t *testing.T) {
 	c := &client{
 		client: http.DefaultClient,
@@ -24,20 +24,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
-
-	log "github.com/sirupsen/logrus"
+	"unicode/utf8"
 
 	"github.com/qiniu/goc/pkg/cover/internal/tool"
-	"github.com/sirupsen/logrus"
 )
 
 var (
@@ -45,6 +43,10 @@ var (
 	ErrCoverPkgFailed = errors.New("fail to inject code to project")
 	// ErrCoverListFailed represents the error that fails to list package dependencies
 	ErrCoverListFailed = errors.New("fail to list package dependencies")
+	// ErrGoNotFound represents the error that the go binary is not found in PATH
+	ErrGoNotFound = errors.New("go binary not found in PATH")
+	// ErrNoStatements represents the error that there is no statement to compute a ratio of
+	ErrNoStatements = errors.New("no statements")
 )
 
 // TestCover is a collection of all counters
@@ -162,7 +164,7 @@ func Execute(coverInfo *CoverInfo) error {
 	}
 
 	if !isDirExist(target) {
-		log.Errorf("Target directory %s not exist", target)
+		logger.Errorf("Target directory %s not exist", target)
 		return ErrCoverPkgFailed
 	}
 	listArgs := []string{"-json"}
@@ -172,7 +174,11 @@ func Execute(coverInfo *CoverInfo) error {
 	listArgs = append(listArgs, "./...")
 	pkgs, err := ListPackages(target, strings.Join(listArgs, " "), newGopath)
 	if err != nil {
-		log.Errorf("Fail to list all packages, the error: %v", err)
+		logger.Errorf("Fail to list all packages, the error: %v", err)
+		return err
+	}
+	if err := checkOverlappingFiles(pkgs); err != nil {
+		logger.Errorf("Fail to instrument the packages, the error: %v", err)
 		return err
 	}
 
@@ -181,9 +187,13 @@ func Execute(coverInfo *CoverInfo) error {
 	allDecl := ""
 	for _, pkg := range pkgs {
 		if pkg.Name == "main" {
-			log.Printf("handle package: %v", pkg.ImportPath)
+			logger.Printf("handle package: %v", pkg.ImportPath)
 			// inject the main package
-			mainCover, mainDecl := AddCounters(pkg, mode, globalCoverVarImportPath)
+			mainCover, mainDecl, err := AddCounters(pkg, mode, globalCoverVarImportPath)
+			if err != nil {
+				logger.Errorf("failed to add counters for package: %s, err: %v", pkg.ImportPath, err)
+				return ErrCoverPkgFailed
+			}
 			allDecl += mainDecl
 			// new a testcover for this service
 			tc := TestCover{
@@ -206,7 +216,11 @@ func Execute(coverInfo *CoverInfo) error {
 
 				//only focus package neither standard Go library nor dependency library
 				if depPkg, ok := pkgs[dep]; ok {
-					packageCover, depDecl := AddCounters(depPkg, mode, globalCoverVarImportPath)
+					packageCover, depDecl, err := AddCounters(depPkg, mode, globalCoverVarImportPath)
+					if err != nil {
+						logger.Errorf("failed to add counters for package: %s, err: %v", depPkg.ImportPath, err)
+						return ErrCoverPkgFailed
+					}
 					allDecl += depDecl
 					tc.DepsCover = append(tc.DepsCover, packageCover)
 					seen[dep] = packageCover
@@ -216,7 +230,7 @@ func Execute(coverInfo *CoverInfo) error {
 			// inject Http Cover APIs
 			var httpCoverApis = fmt.Sprintf("%s/http_cover_apis_auto_generated.go", pkg.Dir)
 			if err := InjectCountersHandlers(tc, httpCoverApis); err != nil {
-				log.Errorf("failed to inject counters for package: %s, err: %v", pkg.ImportPath, err)
+				logger.Errorf("failed to inject counters for package: %s, err: %v", pkg.ImportPath, err)
 				return ErrCoverPkgFailed
 			}
 		}
@@ -228,8 +242,11 @@ func Execute(coverInfo *CoverInfo) error {
 // ListPackages list all packages under specific via go list command
 // The argument newgopath is if you need to go list in a different GOPATH
 func ListPackages(dir string, args string, newgopath string) (map[string]*Package, error) {
+	if _, err := exec.LookPath("go"); err != nil {
+		return nil, ErrGoNotFound
+	}
 	cmd := exec.Command("/bin/bash", "-c", "go list "+args)
-	log.Printf("go list cmd is: %v", cmd.Args)
+	logger.Printf("go list cmd is: %v", cmd.Args)
 	cmd.Dir = dir
 	if newgopath != "" {
 		cmd.Env = append(os.Environ(), fmt.Sprintf("GOPATH=%v", newgopath))
@@ -238,10 +255,10 @@ func ListPackages(dir string, args string, newgopath string) (map[string]*Packag
 	cmd.Stderr = &errbuf
 	out, err := cmd.Output()
 	if err != nil {
-		log.Errorf("excute `go list -json ./...` command failed, err: %v, stdout: %v, stderr: %v", err, string(out), errbuf.String())
+		logger.Errorf("excute `go list -json ./...` command failed, err: %v, stdout: %v, stderr: %v", err, string(out), errbuf.String())
 		return nil, ErrCoverListFailed
 	}
-	log.Infof("\n%v", errbuf.String())
+	logger.Infof("\n%v", errbuf.String())
 	dec := json.NewDecoder(bytes.NewReader(out))
 	pkgs := make(map[string]*Package, 0)
 	for {
@@ -250,11 +267,11 @@ func ListPackages(dir string, args string, newgopath string) (map[string]*Packag
 			if err == io.EOF {
 				break
 			}
-			log.Errorf("reading go list output: %v", err)
+			logger.Errorf("reading go list output: %v", err)
 			return nil, ErrCoverListFailed
 		}
 		if pkg.Error != nil {
-			log.Errorf("list package %s failed with output: %v", pkg.ImportPath, pkg.Error)
+			logger.Errorf("list package %s failed with output: %v", pkg.ImportPath, pkg.Error)
 			return nil, ErrCoverPkgFailed
 		}
 
@@ -267,22 +284,53 @@ func ListPackages(dir string, args string, newgopath string) (map[string]*Packag
 	return pkgs, nil
 }
 
+// checkOverlappingFiles returns an error if a source file belongs to two packages, e.g.
+// when overlapping coverpkg patterns list the same directory under two import paths.
+// Such a file would be instrumented twice and its statements counted twice.
+func checkOverlappingFiles(pkgs map[string]*Package) error {
+	var importPaths []string
+	for importPath := range pkgs {
+		importPaths = append(importPaths, importPath)
+	}
+	sort.Strings(importPaths)
+
+	owners := make(map[string]string)
+	for _, importPath := range importPaths {
+		pkg := pkgs[importPath]
+		for _, file := range append(append([]string(nil), pkg.GoFiles...), pkg.CgoFiles...) {
+			p := filepath.Join(pkg.Dir, file)
+			if real, err := filepath.EvalSymlinks(p); err == nil {
+				p = real
+			}
+			if owner, ok := owners[p]; ok {
+				return fmt.Errorf("file %s is instrumented under both %s and %s", p, owner, importPath)
+			}
+			owners[p] = importPath
+		}
+	}
+	return nil
+}
+
 // AddCounters is different from official go tool cover
 // 1. only inject covervar++ into source file
 // 2. no declarartions for these covervars
 // 3. return the declarations as string
-func AddCounters(pkg *Package, mode string, globalCoverVarImportPath string) (*PackageCover, string) {
+func AddCounters(pkg *Package, mode string, globalCoverVarImportPath string) (*PackageCover, string, error) {
 	coverVarMap := declareCoverVars(pkg)
 
 	decl := ""
 	for file, coverVar := range coverVarMap {
-		decl += "\n" + tool.Annotate(path.Join(pkg.Dir, file), mode, coverVar.Var, globalCoverVarImportPath) + "\n"
+		fileDecl, err := tool.Annotate(path.Join(pkg.Dir, file), mode, coverVar.Var, globalCoverVarImportPath)
+		if err != nil {
+			return nil, "", err
+		}
+		decl += "\n" + fileDecl + "\n"
 	}
 
 	return &PackageCover{
 		Package: pkg,
 		Vars:    coverVarMap,
-	}, decl
+	}, decl, nil
 }
 
 func isDirExist(path string) bool {
@@ -377,6 +425,57 @@ func declareCoverVars(p *Package) map[string]*FileVar {
 	return coverVars
 }
 
+// SourceFileVar pairs a source file of a package with its cover variable
+type SourceFileVar struct {
+	File string // file name relative to the package directory
+	Var  *FileVar
+}
+
+// OrderedCoverVars returns the same cover variables as declareCoverVars,
+// but as a slice ordered by the file index used in the variable names,
+// so that manifests built from it are stable across runs
+func OrderedCoverVars(p *Package) []SourceFileVar {
+	coverVars := declareCoverVars(p)
+	ordered := make([]SourceFileVar, 0, len(coverVars))
+	for _, files := range [][]string{p.GoFiles, p.CgoFiles} {
+		for _, file := range files {
+			ordered = append(ordered, SourceFileVar{File: file, Var: coverVars[file]})
+		}
+	}
+	return ordered
+}
+
+// UninstrumentedFiles returns the files declared with a cover variable for the packages
+// of which none is in the collected profile, sorted, e.g. the files of a package whose
+// instrumentation failed silently, which would otherwise show as a missing or 0% package.
+// A package with some of its files in the profile is fine: a file without statements,
+// say of declarations only, has no blocks.
+func UninstrumentedFiles(pkgs map[string]*Package, list CoverageList) []string {
+	collected := make(map[string]bool, len(list))
+	for _, c := range list {
+		collected[c.FileName] = true
+	}
+	var files []string
+	for _, p := range pkgs {
+		vars := OrderedCoverVars(p)
+		absent := len(vars) > 0
+		for _, v := range vars {
+			if collected[v.Var.File] {
+				absent = false
+				break
+			}
+		}
+		if !absent {
+			continue
+		}
+		for _, v := range vars {
+			files = append(files, v.Var.File)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
 func declareCacheVars(in *PackageCover) map[string]*FileVar {
 	sum := sha256.Sum256([]byte(in.Package.ImportPath))
 	h := fmt.Sprintf("%x", sum[:5])
@@ -424,39 +523,265 @@ type Coverage struct {
 	NCoveredStmts int
 	NAllStmts     int
 	LineCovLink   string
+	Mode          string       // mode of the profile the coverage is converted from
+	Blocks        []CoverBlock // code blocks of the file, retained when converted from a profile
+}
+
+// CoverBlock is a code block in a profile
+type CoverBlock struct {
+	FileName  string // the file the code block is in
+	StartLine int
+	StartCol  int
+	EndLine   int
+	EndCol    int
+	NumStmt   int    // number of statements in the code block
+	Count     int64  // number of times the block is covered, int64 as it overflows int32 in long running atomic mode
+	FuncName  string // name of the enclosing function, only set when source is known
+}
+
+// ParseOptions controls how a profile is converted to CoverageList
+type ParseOptions struct {
+	// SkipSynthetic drops the blocks which are not real user code, i.e. zero-statement or
+	// zero-width blocks and the blocks of the http_cover_apis_auto_generated.go and
+	// cache_vars_auto_generated_* files goc generates
+	SkipSynthetic bool
+	// StrictHeader requires the profile to start with a "mode:" line, otherwise a
+	// profile without it is parsed in "set" mode and a warning is reported, and a first
+	// line which is not a block either is skipped with a warning
+	StrictHeader bool
+	// Embedded locates the profile within a noisy stream, e.g. the logs of a service dumping
+	// it: the lines before the first "mode:" line and from the first line after it which is
+	// not a block are ignored. It is an error if the stream has no "mode:" line.
+	Embedded bool
+	// Funcs, if not nil, sets the FuncName of every block from the source files it parses,
+	// so it can be shared by the parses of multiple profiles. The files not found under
+	// its root are reported as warnings and their blocks have no FuncName.
+	Funcs *FuncCache
+	// RejectUnknownHeaders fails on the "key: value" header lines other than "mode:", e.g.
+	// injected by incompatible producers, which are otherwise skipped with a warning
+	RejectUnknownHeaders bool
+	// OnWarning is called with the warnings of the parsing, if not nil
+	OnWarning func(msg string)
+}
+
+// headerRegexp matches a "key: value" header line, which a block line never is
+var headerRegexp = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9_-]*):(\s|$)`)
+
+// headerKey returns the key of a header line
+func headerKey(row string) (string, bool) {
+	if strings.HasPrefix(row, "mode:") {
+		return "mode", true
+	}
+	m := headerRegexp.FindStringSubmatch(row)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// checkHeader checks a header line of the profile: the first "mode:" line sets the mode if
+// it is not known yet, a repeated one of concatenated profiles must have the same mode, and
+// the unknown keys are skipped unless RejectUnknownHeaders is set
+func (opts *ParseOptions) checkHeader(key, row string, mode *string) error {
+	if key == "mode" {
+		m := strings.TrimSpace(strings.TrimPrefix(row, "mode:"))
+		if *mode == "" {
+			*mode = m
+		} else if m != *mode {
+			return fmt.Errorf("mode mismatch: %s vs %s", *mode, m)
+		}
+		return nil
+	}
+	if opts.RejectUnknownHeaders {
+		return fmt.Errorf("unknown header key %q: %s", key, row)
+	}
+	opts.warn("skip unknown header line: %s", row)
+	return nil
 }
 
-type codeBlock struct {
-	fileName      string // the file the code block is in
-	numStatements int    // number of statements in the code block
-	coverageCount int    // number of times the block is covered
+func (opts *ParseOptions) warn(format string, args ...interface{}) {
+	if opts.OnWarning != nil {
+		opts.OnWarning(fmt.Sprintf(format, args...))
+	}
 }
 
 // CovList converts profile to CoverageList struct
 func CovList(f io.Reader) (g CoverageList, err error) {
-	scanner := bufio.NewScanner(f)
-	scanner.Scan() // discard first line
+	return CovListWithOptions(f, ParseOptions{})
+}
+
+// CovListWithOptions converts profile to CoverageList struct with the given options,
+// blank lines are skipped
+func CovListWithOptions(f io.Reader, opts ParseOptions) (g CoverageList, err error) {
+	scanner := bufio.NewScanner(skipBOM(f))
 	g = NewCoverageList()
+	if opts.Embedded {
+		for found := false; !found; found = strings.HasPrefix(scanner.Text(), "mode:") {
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					return nil, err
+				}
+				return nil, errors.New("no profile found in the stream")
+			}
+		}
+	} else if !scanner.Scan() {
+		return g, scanner.Err()
+	}
+	// the mode is unknown until a mode line, a profile without it is in set mode
+	mode := ""
+	pending := ""
+	var missing map[string]bool
+	if header := scanner.Text(); strings.HasPrefix(header, "mode:") {
+		mode = strings.TrimSpace(strings.TrimPrefix(header, "mode:"))
+	} else if opts.StrictHeader {
+		return nil, fmt.Errorf("bad mode line: %s", header)
+	} else if _, err := toBlock(header); err == nil {
+		pending = header
+	} else if _, ok := headerKey(header); ok {
+		// an injected header before the mode line is checked like the others
+		pending = header
+	} else {
+		opts.warn("skip the first line of the profile, it is neither a mode line nor a block: %s", header)
+	}
 
-	for scanner.Scan() {
-		row := scanner.Text()
+	for pending != "" || scanner.Scan() {
+		row := pending
+		if row == "" {
+			row = scanner.Text()
+		}
+		pending = ""
+		if strings.TrimSpace(row) == "" {
+			continue
+		}
 		blk, err := toBlock(row)
 		if err != nil {
+			if opts.Embedded {
+				// the end of the embedded profile
+				break
+			}
+			if key, ok := headerKey(row); ok {
+				if err := opts.checkHeader(key, row, &mode); err != nil {
+					return nil, err
+				}
+				continue
+			}
 			return nil, err
 		}
+		if mode == "" {
+			opts.warn("profile has no mode line, use set mode")
+			mode = "set"
+		}
+		if opts.SkipSynthetic && blk.isSynthetic() {
+			continue
+		}
+		if opts.Funcs != nil {
+			funcs, ok, err := opts.Funcs.funcsOf(blk.FileName)
+			if err != nil {
+				return nil, err
+			}
+			if !ok && !missing[blk.FileName] {
+				if missing == nil {
+					missing = make(map[string]bool)
+				}
+				missing[blk.FileName] = true
+				opts.warn("source file of %s not found under %s", blk.FileName, opts.Funcs.srcRoot)
+			}
+			blk.FuncName = funcNameOf(blk, funcs)
+		}
 		blk.addToGroupCov(&g)
 	}
+	g.setMode(mode)
 	return
 }
 
-// ReadFileToCoverList coverts profile file to CoverageList struct
+func (g CoverageList) setMode(mode string) {
+	for i := range g {
+		g[i].Mode = mode
+	}
+}
+
+// isSynthetic reports whether the block is injected by the instrumentation rather than user code
+func (blk *CoverBlock) isSynthetic() bool {
+	if blk.NumStmt == 0 || (blk.StartLine == blk.EndLine && blk.StartCol == blk.EndCol) {
+		return true
+	}
+	base := path.Base(blk.FileName)
+	return base == "http_cover_apis_auto_generated.go" || strings.HasPrefix(base, "cache_vars_auto_generated_")
+}
+
+// utf8BOM is written at the beginning of profiles by some Windows toolchains
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// skipBOM discards the leading UTF-8 BOM of the reader if there is one
+func skipBOM(f io.Reader) io.Reader {
+	br := bufio.NewReader(f)
+	if prefix, err := br.Peek(len(utf8BOM)); err == nil && bytes.Equal(prefix, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	return br
+}
+
+// ParseBlocks reads the mode header and all the blocks of a profile in input order, not
+// grouped by file, e.g. to round-trip a profile or to build custom aggregations.
+// The blocks must follow a "mode:" line. The other "key: value" header lines, e.g. injected
+// before the mode line, and blank lines are skipped.
+func ParseBlocks(f io.Reader) (mode string, blocks []CoverBlock, err error) {
+	mode, err = scanProfile(f, func(blk *CoverBlock) error {
+		blocks = append(blocks, *blk)
+		return nil
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return mode, blocks, nil
+}
+
+// scanProfile reads the mode header of a profile and calls fn for every block in input order,
+// the header lines are checked like the lenient CovListWithOptions does
+func scanProfile(f io.Reader, fn func(blk *CoverBlock) error) (mode string, err error) {
+	scanner := bufio.NewScanner(skipBOM(f))
+	var opts ParseOptions
+	for scanner.Scan() {
+		row := scanner.Text()
+		if strings.TrimSpace(row) == "" {
+			continue
+		}
+		// the mode line, repeated by concatenated profiles, or an injected header
+		if key, ok := headerKey(row); ok {
+			if err := opts.checkHeader(key, row, &mode); err != nil {
+				return "", err
+			}
+			continue
+		}
+		if mode == "" {
+			return "", fmt.Errorf("bad mode line: %s", row)
+		}
+		blk, err := toBlock(row)
+		if err != nil {
+			return "", err
+		}
+		if err := fn(blk); err != nil {
+			return "", err
+		}
+	}
+	return mode, scanner.Err()
+}
+
+// ReadFileToCoverList coverts profile file to CoverageList struct,
+// the file may be compressed, see OpenProfile
 func ReadFileToCoverList(path string) (g CoverageList, err error) {
-	f, err := ioutil.ReadFile(path)
+	f, err := os.Open(path)
 	if err != nil {
-		logrus.Errorf("Open file %s failed!", path)
+		logger.Errorf("Open file %s failed!", path)
 		return nil, err
 	}
-	g, err = CovList(bytes.NewReader(f))
+	defer f.Close()
+	r, err := OpenProfile(f)
+	if err != nil {
+		return nil, fmt.Errorf("read profile %s failed: %w", path, err)
+	}
+	defer r.Close()
+	g, err = CovList(r)
 	return
 }
 
@@ -467,37 +792,53 @@ func NewCoverageList() CoverageList {
 }
 
 func newCoverage(name string) *Coverage {
-	return &Coverage{name, 0, 0, ""}
+	return &Coverage{FileName: name}
 }
 
-// convert a line in profile file to a codeBlock struct
-func toBlock(line string) (res *codeBlock, err error) {
-	slice := strings.Split(line, " ")
+// convert a line in profile file to a CoverBlock struct
+func toBlock(line string) (res *CoverBlock, err error) {
+	// the file name may contain a colon, but the fields after the last one may not
+	colon := strings.LastIndex(line, ":")
+	if colon < 0 {
+		return nil, fmt.Errorf("the profile line %s is not expected", line)
+	}
+	slice := strings.Fields(line[colon+1:])
 	if len(slice) != 3 {
 		return nil, fmt.Errorf("the profile line %s is not expected", line)
 	}
-	blockName := slice[0]
-	nStmts, _ := strconv.Atoi(slice[1])
-	coverageCount, _ := strconv.Atoi(slice[2])
-	return &codeBlock{
-		fileName:      blockName[:strings.Index(blockName, ":")],
-		numStatements: nStmts,
-		coverageCount: coverageCount,
-	}, nil
+	nStmts, err := strconv.Atoi(slice[1])
+	if err != nil {
+		return nil, fmt.Errorf("the profile line %s is not expected", line)
+	}
+	coverageCount, err := strconv.ParseInt(slice[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("the profile line %s is not expected", line)
+	}
+	res = &CoverBlock{
+		FileName: line[:colon],
+		NumStmt:  nStmts,
+		Count:    coverageCount,
+	}
+	_, err = fmt.Sscanf(slice[0], "%d.%d,%d.%d", &res.StartLine, &res.StartCol, &res.EndLine, &res.EndCol)
+	if err != nil {
+		return nil, fmt.Errorf("the profile line %s is not expected", line)
+	}
+	return res, nil
 }
 
 // add blk Coverage to file group Coverage
-func (blk *codeBlock) addToGroupCov(g *CoverageList) {
-	if g.size() == 0 || g.lastElement().Name() != blk.fileName {
+func (blk *CoverBlock) addToGroupCov(g *CoverageList) {
+	if g.size() == 0 || g.lastElement().Name() != blk.FileName {
 		// when a new file name is processed
-		coverage := newCoverage(blk.fileName)
+		coverage := newCoverage(blk.FileName)
 		g.append(coverage)
 	}
 	cov := g.lastElement()
-	cov.NAllStmts += blk.numStatements
-	if blk.coverageCount > 0 {
-		cov.NCoveredStmts += blk.numStatements
+	cov.NAllStmts += blk.NumStmt
+	if blk.Count > 0 {
+		cov.NCoveredStmts += blk.NumStmt
 	}
+	cov.Blocks = append(cov.Blocks, *blk)
 }
 
 func (g CoverageList) size() int {
@@ -522,10 +863,16 @@ func (g CoverageList) Sort() {
 // TotalPercentage returns the total percentage of coverage
 func (g CoverageList) TotalPercentage() string {
 	ratio, err := g.TotalRatio()
-	if err == nil {
-		return PercentStr(ratio)
+	return percentageFormatter(ratio, err == nil)
+}
+
+// totalStmts returns the number of covered statements and all statements of the list
+func (g CoverageList) totalStmts() (covered, all int) {
+	for _, c := range g {
+		covered += c.NCoveredStmts
+		all += c.NAllStmts
 	}
-	return "N/A"
+	return
 }
 
 // TotalRatio returns the total ratio of covered statements
@@ -548,6 +895,92 @@ func (g CoverageList) Map() map[string]Coverage {
 	return m
 }
 
+// GroupByPackage sums the coverage of the files per package, the FileName of
+// each returned Coverage is the package import path. The result is sorted.
+func (g CoverageList) GroupByPackage() CoverageList {
+	res := NewCoverageList()
+	index := make(map[string]int)
+	for _, c := range g {
+		pkg := path.Dir(filepath.ToSlash(c.FileName))
+		i, ok := index[pkg]
+		if !ok {
+			i = len(res)
+			index[pkg] = i
+			res = append(res, Coverage{FileName: pkg})
+		}
+		res[i].NCoveredStmts += c.NCoveredStmts
+		res[i].NAllStmts += c.NAllStmts
+		res[i].Blocks = append(res[i].Blocks, c.Blocks...)
+	}
+	res.Sort()
+	return res
+}
+
+// Coalesce merges the entries with the same file name by summing their counts,
+// the order of the first occurrences is kept. It makes Map lossless for lists
+// converted from concatenated profiles.
+func (g CoverageList) Coalesce() CoverageList {
+	res := NewCoverageList()
+	index := make(map[string]int)
+	for _, c := range g {
+		i, ok := index[c.Name()]
+		if !ok {
+			index[c.Name()] = len(res)
+			c.Blocks = append([]CoverBlock(nil), c.Blocks...)
+			res = append(res, c)
+			continue
+		}
+		res[i].NCoveredStmts += c.NCoveredStmts
+		res[i].NAllStmts += c.NAllStmts
+		res[i].Blocks = append(res[i].Blocks, c.Blocks...)
+	}
+	return res
+}
+
+// MaxFileNameLen returns the length in runes of the longest file name of the list, e.g. to
+// size the file column of a report. It should be called after the names are rewritten,
+// e.g. by Redact, as that changes their lengths.
+func (g CoverageList) MaxFileNameLen() int {
+	max := 0
+	for _, c := range g {
+		if n := utf8.RuneCountInString(c.Name()); n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// Redact returns a copy of the list whose file names, the ones of the retained blocks
+// included, have the longest matching prefix of prefixes replaced by replacement, e.g.
+// to publish reports without the internal absolute paths. It should run before exporting.
+func (g CoverageList) Redact(prefixes []string, replacement string) CoverageList {
+	sorted := append([]string(nil), prefixes...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	redact := func(name string) string {
+		for _, p := range sorted {
+			if p != "" && strings.HasPrefix(name, p) {
+				return replacement + name[len(p):]
+			}
+		}
+		return name
+	}
+
+	res := make(CoverageList, len(g))
+	for i, c := range g {
+		c.FileName = redact(c.FileName)
+		if c.Blocks != nil {
+			blocks := make([]CoverBlock, len(c.Blocks))
+			for j, b := range c.Blocks {
+				b.FileName = redact(b.FileName)
+				blocks[j] = b
+			}
+			c.Blocks = blocks
+		}
+		res[i] = c
+	}
+	return res
+}
+
 // Name returns the file name
 func (c *Coverage) Name() string {
 	return c.FileName
@@ -556,10 +989,7 @@ func (c *Coverage) Name() string {
 // Percentage returns the percentage of statements covered
 func (c *Coverage) Percentage() string {
 	ratio, err := c.Ratio()
-	if err == nil {
-		return PercentStr(ratio)
-	}
-	return "N/A"
+	return percentageFormatter(ratio, err == nil)
 }
 
 // Ratio calculates the ratio of statements in a profile
@@ -572,7 +1002,264 @@ func (c *Coverage) Ratio() (ratio float32, err error) {
 	return
 }
 
+// BasisPoints returns the ratio in basis points, 0 to 10000, rounded down by integer
+// arithmetic rather than float32, so that gating on sub-percent movements never depends
+// on the float rounding. The file with no statement has 0.
+func (c *Coverage) BasisPoints() int {
+	return scaledRatio(c.NCoveredStmts, c.NAllStmts, 10000)
+}
+
+// RatioMilli returns the ratio in thousandths, 0 to 1000, rounded down like BasisPoints,
+// e.g. to bucket or compare ratios deterministically. The file with no statement has 0.
+func (c *Coverage) RatioMilli() int {
+	return scaledRatio(c.NCoveredStmts, c.NAllStmts, 1000)
+}
+
+// TotalBasisPoints returns the total ratio of the list in basis points like BasisPoints
+func (g CoverageList) TotalBasisPoints() int {
+	covered, all := g.totalStmts()
+	return scaledRatio(covered, all, 10000)
+}
+
+// scaledRatio returns covered*scale/all by integer arithmetic, 0 if all is 0
+func scaledRatio(covered, all int, scale int64) int {
+	if all == 0 {
+		return 0
+	}
+	return int(int64(covered) * scale / int64(all))
+}
+
+// RatioAtLeast is the ratio of the statements whose block is hit at least minHits times,
+// which tells the paths exercised only once by chance. It needs the retained blocks and,
+// as set mode only records whether a block is hit, count or atomic mode when minHits > 1.
+func (c *Coverage) RatioAtLeast(minHits int) (float32, error) {
+	if c.Mode == "set" && minHits > 1 {
+		return 0, fmt.Errorf("[%s] is in set mode which has no hit counts", c.Name())
+	}
+	return c.RatioWith(HitAtLeast(int64(minHits)))
+}
+
+// CoveredPredicate decides whether the statements of a block count as covered
+type CoveredPredicate func(b CoverBlock) bool
+
+// AnyHit is the default CoveredPredicate, a block hit at least once is covered
+func AnyHit(b CoverBlock) bool {
+	return b.Count > 0
+}
+
+// HitAtLeast returns a CoveredPredicate of the blocks hit at least n times, and at least once
+func HitAtLeast(n int64) CoveredPredicate {
+	return func(b CoverBlock) bool {
+		return b.Count > 0 && b.Count >= n
+	}
+}
+
+// RatioWith is the ratio of the statements of the retained blocks which are covered by
+// the predicate, AnyHit if nil, so that one parsed list gives multiple metrics
+func (c *Coverage) RatioWith(covered CoveredPredicate) (float32, error) {
+	if covered == nil {
+		covered = AnyHit
+	}
+	n, all := 0, 0
+	for _, b := range c.Blocks {
+		all += b.NumStmt
+		if covered(b) {
+			n += b.NumStmt
+		}
+	}
+	if all == 0 {
+		return 0, fmt.Errorf("[%s] has 0 statement", c.Name())
+	}
+	return float32(n) / float32(all), nil
+}
+
+// RatioInLineRange returns the ratio of the statements of the retained blocks overlapping
+// the lines start to end inclusive, e.g. of a function under review. A block partially in
+// the range counts as a whole, as a profile does not tell the lines of its statements.
+// An error wrapping ErrNoStatements is returned if no statement is in the range.
+func (c *Coverage) RatioInLineRange(start, end int) (float32, error) {
+	if start > end {
+		return 0, fmt.Errorf("bad line range %d-%d", start, end)
+	}
+	covered, all := 0, 0
+	for _, b := range c.Blocks {
+		if b.StartLine > end || b.EndLine < start {
+			continue
+		}
+		all += b.NumStmt
+		if b.Count > 0 {
+			covered += b.NumStmt
+		}
+	}
+	if all == 0 {
+		return 0, fmt.Errorf("%w: [%s] lines %d-%d", ErrNoStatements, c.Name(), start, end)
+	}
+	return float32(covered) / float32(all), nil
+}
+
+// WithCovered returns a copy of the list whose covered statements are recounted from the
+// retained blocks by the predicate, AnyHit if nil, so that every report of the list uses it.
+// The files without retained blocks are kept as is.
+func (g CoverageList) WithCovered(covered CoveredPredicate) CoverageList {
+	if covered == nil {
+		covered = AnyHit
+	}
+	res := make(CoverageList, len(g))
+	for i, c := range g {
+		if len(c.Blocks) > 0 {
+			c.NCoveredStmts = 0
+			for _, b := range c.Blocks {
+				if covered(b) {
+					c.NCoveredStmts += b.NumStmt
+				}
+			}
+		}
+		res[i] = c
+	}
+	return res
+}
+
+// TotalLineCount returns the number of lines spanned by the retained blocks,
+// a line holding multiple statements is counted once
+func (c *Coverage) TotalLineCount() int {
+	total, _ := c.lineCounts()
+	return total
+}
+
+// CoveredLineCount returns the number of lines spanned by at least one covered block,
+// a line holding multiple statements is counted once
+func (c *Coverage) CoveredLineCount() int {
+	_, covered := c.lineCounts()
+	return covered
+}
+
+// LineTotals returns the number of lines spanned by at least one covered block and by
+// any block of the retained blocks of the list, the line based counterpart of the total
+// statements like LCOV reports. A line holding multiple statements is counted once, also
+// when its blocks are in several entries of the list, e.g. of a package.
+func (g CoverageList) LineTotals() (coveredLines, totalLines int) {
+	type fileLine struct {
+		file string
+		line int
+	}
+	lines := make(map[fileLine]bool)
+	for _, c := range g {
+		for _, b := range c.Blocks {
+			if b.NumStmt == 0 {
+				continue
+			}
+			file := b.FileName
+			if file == "" {
+				file = c.FileName
+			}
+			for l := b.StartLine; l <= b.EndLine; l++ {
+				key := fileLine{file: file, line: l}
+				lines[key] = lines[key] || b.Count > 0
+			}
+		}
+	}
+	for _, hit := range lines {
+		totalLines++
+		if hit {
+			coveredLines++
+		}
+	}
+	return coveredLines, totalLines
+}
+
+// LineCoverage is the coverage of a source line by the blocks spanning it
+type LineCoverage struct {
+	Line         int   `json:"line"`
+	CoveredStmts int   `json:"covered_stmts"`
+	AllStmts     int   `json:"all_stmts"`
+	Hits         int64 `json:"hits"` // the max count of the blocks
+}
+
+// Fraction returns the covered part of the line, e.g. to shade an editor gutter
+func (l LineCoverage) Fraction() float32 {
+	if l.AllStmts == 0 {
+		return 0
+	}
+	return float32(l.CoveredStmts) / float32(l.AllStmts)
+}
+
+// CoveredLines returns the lines spanned by the retained blocks sorted by line, each with
+// the statements of its blocks, so that a line of a covered and an uncovered block is
+// partially covered instead of all or nothing. As a profile does not tell the lines of
+// the statements in a block, every line of a block gets all its statements.
+func (c *Coverage) CoveredLines() []LineCoverage {
+	index := make(map[int]int)
+	var lines []LineCoverage
+	for _, b := range c.Blocks {
+		if b.NumStmt == 0 {
+			continue
+		}
+		for l := b.StartLine; l <= b.EndLine; l++ {
+			i, ok := index[l]
+			if !ok {
+				i = len(lines)
+				index[l] = i
+				lines = append(lines, LineCoverage{Line: l})
+			}
+			lines[i].AllStmts += b.NumStmt
+			if b.Count > 0 {
+				lines[i].CoveredStmts += b.NumStmt
+			}
+			if b.Count > lines[i].Hits {
+				lines[i].Hits = b.Count
+			}
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Line < lines[j].Line })
+	return lines
+}
+
+func (c *Coverage) lineCounts() (total, covered int) {
+	lines := make(map[int]bool)
+	for _, b := range c.Blocks {
+		if b.NumStmt == 0 {
+			continue
+		}
+		for l := b.StartLine; l <= b.EndLine; l++ {
+			lines[l] = lines[l] || b.Count > 0
+		}
+	}
+	for _, hit := range lines {
+		total++
+		if hit {
+			covered++
+		}
+	}
+	return
+}
+
 // PercentStr converts a fraction number to percentage string representation
 func PercentStr(f float32) string {
-	return fmt.Sprintf("%.1f%%", f*100)
+	return percentStrWithPrecision(f, 1)
+}
+
+func percentStrWithPrecision(f float32, precision int) string {
+	return fmt.Sprintf("%.*f%%", precision, f*100)
+}
+
+// PercentageFormatter formats a coverage ratio, valid is false when the ratio is not available
+type PercentageFormatter func(ratio float32, valid bool) string
+
+// DefaultPercentageFormatter formats the ratio like "66.7%", or "N/A" when it is not available
+func DefaultPercentageFormatter(ratio float32, valid bool) string {
+	if !valid {
+		return "N/A"
+	}
+	return PercentStr(ratio)
+}
+
+var percentageFormatter PercentageFormatter = DefaultPercentageFormatter
+
+// SetPercentageFormatter sets the formatter used by Percentage, TotalPercentage and the reports,
+// nil restores DefaultPercentageFormatter
+func SetPercentageFormatter(f PercentageFormatter) {
+	if f == nil {
+		f = DefaultPercentageFormatter
+	}
+	percentageFormatter = f
 }
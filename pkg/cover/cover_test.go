@@ -17,6 +17,8 @@
 package cover
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -47,11 +49,119 @@ func TestRatioErr(t *testing.T) {
 	assert.NotEqual(t, err, nil)
 }
 
+func TestRatioAtLeast(t *testing.T) {
+	c := &Coverage{FileName: "fake-coverage", Mode: "count", Blocks: []CoverBlock{
+		{NumStmt: 1, Count: 0},
+		{NumStmt: 2, Count: 1},
+		{NumStmt: 3, Count: 3},
+		{NumStmt: 4, Count: 10},
+	}}
+	items := []struct {
+		minHits int
+		expect  float32
+	}{
+		{minHits: 0, expect: 0.9},
+		{minHits: 1, expect: 0.9},
+		{minHits: 3, expect: 0.7},
+		{minHits: 11, expect: 0},
+	}
+	for _, tc := range items {
+		ratio, err := c.RatioAtLeast(tc.minHits)
+		assert.NoError(t, err)
+		assert.InDelta(t, tc.expect, ratio, 1e-6)
+	}
+
+	c.Mode = "set"
+	_, err := c.RatioAtLeast(1)
+	assert.NoError(t, err)
+	_, err = c.RatioAtLeast(3)
+	assert.Error(t, err)
+
+	_, err = testCoverage().RatioAtLeast(1)
+	assert.Error(t, err)
+}
+
+func TestBasisPoints(t *testing.T) {
+	items := []struct {
+		covered, all int
+		expect       int
+	}{
+		{covered: 0, all: 0, expect: 0},
+		{covered: 1, all: 3, expect: 3333},
+		{covered: 2, all: 3, expect: 6666},
+		{covered: 7, all: 7, expect: 10000},
+		{covered: 1999999, all: 2000000, expect: 9999},
+	}
+	for _, tc := range items {
+		c := &Coverage{NCoveredStmts: tc.covered, NAllStmts: tc.all}
+		assert.Equal(t, tc.expect, c.BasisPoints())
+		assert.Equal(t, tc.expect/10, c.RatioMilli())
+	}
+	list := CoverageList{{NCoveredStmts: 1, NAllStmts: 2}, {NCoveredStmts: 0, NAllStmts: 2}}
+	assert.Equal(t, 2500, list.TotalBasisPoints())
+}
+
+func TestCoveredPredicate(t *testing.T) {
+	list := CoverageList{
+		{FileName: "a.go", NCoveredStmts: 9, NAllStmts: 10, Mode: "count", Blocks: []CoverBlock{
+			{NumStmt: 1, Count: 0},
+			{NumStmt: 2, Count: 1},
+			{NumStmt: 3, Count: 3},
+			{NumStmt: 4, Count: 10},
+		}},
+		{FileName: "b.go", NCoveredStmts: 1, NAllStmts: 2},
+	}
+	items := []struct {
+		covered       CoveredPredicate
+		expectRatio   float32
+		expectCovered int
+	}{
+		{covered: nil, expectRatio: 0.9, expectCovered: 9},
+		{covered: AnyHit, expectRatio: 0.9, expectCovered: 9},
+		{covered: HitAtLeast(3), expectRatio: 0.7, expectCovered: 7},
+		{covered: func(b CoverBlock) bool { return b.NumStmt == 1 }, expectRatio: 0.1, expectCovered: 1},
+	}
+	for _, tc := range items {
+		ratio, err := list[0].RatioWith(tc.covered)
+		assert.NoError(t, err)
+		assert.InDelta(t, tc.expectRatio, ratio, 1e-6)
+
+		recounted := list.WithCovered(tc.covered)
+		assert.Equal(t, tc.expectCovered, recounted[0].NCoveredStmts)
+		// no retained blocks
+		assert.Equal(t, 1, recounted[1].NCoveredStmts)
+	}
+	// the list itself is untouched
+	assert.Equal(t, 9, list[0].NCoveredStmts)
+
+	_, err := list[1].RatioWith(nil)
+	assert.Error(t, err)
+}
+
 func TestPercentageNA(t *testing.T) {
 	c := &Coverage{FileName: "fake-coverage", NCoveredStmts: 200, NAllStmts: 0}
 	assert.Equal(t, "N/A", c.Percentage())
 }
 
+func TestSetPercentageFormatter(t *testing.T) {
+	defer SetPercentageFormatter(nil)
+
+	SetPercentageFormatter(func(ratio float32, valid bool) string {
+		if !valid {
+			return "-"
+		}
+		return strings.Replace(fmt.Sprintf("%.1f %%", ratio*100), ".", ",", 1)
+	})
+	c := &Coverage{FileName: "fake-coverage", NCoveredStmts: 2, NAllStmts: 3}
+	assert.Equal(t, "66,7 %", c.Percentage())
+	assert.Equal(t, "66,7 %", CoverageList{*c}.TotalPercentage())
+	c.NAllStmts = 0
+	assert.Equal(t, "-", c.Percentage())
+
+	SetPercentageFormatter(nil)
+	assert.Equal(t, "N/A", c.Percentage())
+}
+
 func TestCovList(t *testing.T) {
 	fileName := "qiniu.com/kodo/apiserver/server/main.go"
 	fileName1 := "qiniu.com/kodo/apiserver/server/svr.go"
@@ -79,6 +189,13 @@ func TestCovList(t *testing.T) {
 				fileName1 + ":42.49,43.13 1 0\n",
 			expectPer: []string{"100.0%", "0.0%"},
 		},
+		// irregular spacing between fields
+		{
+			profile: "mode: atomic\n" +
+				fileName + ":32.49,33.13   1\t30 \n" +
+				fileName + ":42.49,43.13  1  0\r\n",
+			expectPer: []string{"50.0%"},
+		},
 	}
 
 	for _, tc := range items {
@@ -92,6 +209,367 @@ func TestCovList(t *testing.T) {
 	}
 }
 
+func TestCovListWithoutHeader(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	profile := fileName + ":32.49,33.13 1 30\n" +
+		fileName + ":42.49,43.13 1 0\n"
+
+	var warnings []string
+	c, err := CovListWithOptions(strings.NewReader(profile), ParseOptions{
+		OnWarning: func(msg string) { warnings = append(warnings, msg) },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(warnings))
+	assert.Equal(t, "set", c[0].Mode)
+	assert.Equal(t, 2, len(c[0].Blocks))
+	assert.Equal(t, "50.0%", c[0].Percentage())
+
+	_, err = CovListWithOptions(strings.NewReader(profile), ParseOptions{StrictHeader: true})
+	assert.Error(t, err)
+
+	c, err = CovListWithOptions(strings.NewReader("mode: count\n"+profile), ParseOptions{StrictHeader: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "count", c[0].Mode)
+
+	c, err = CovList(strings.NewReader(""))
+	assert.NoError(t, err)
+	assert.Empty(t, c)
+
+	warnings = nil
+	c, err = CovListWithOptions(strings.NewReader("some banner\n"+profile), ParseOptions{
+		OnWarning: func(msg string) { warnings = append(warnings, msg) },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(warnings)) // the skipped line and the missing mode line
+	assert.Equal(t, "set", c[0].Mode)
+	assert.Equal(t, 2, len(c[0].Blocks))
+
+	_, err = CovListWithOptions(strings.NewReader("some banner\n"+profile), ParseOptions{StrictHeader: true})
+	assert.Error(t, err)
+
+	// the mode line after a skipped first line is the mode of the profile
+	c, err = CovList(strings.NewReader("some banner\nmode: count\n" + profile))
+	assert.NoError(t, err)
+	assert.Equal(t, "count", c[0].Mode)
+
+	// the blocks before the mode line are in the set mode
+	_, err = CovList(strings.NewReader(profile + "mode: count\n"))
+	assert.Error(t, err)
+}
+
+func TestCovListBlankLines(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	profile := "mode: count\n" +
+		fileName + ":32.49,33.13 1 30\n" +
+		"\n" +
+		fileName + ":42.49,43.13 1 0\n" +
+		"\n\n"
+
+	c, err := CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(c))
+	assert.Equal(t, 2, len(c[0].Blocks))
+	assert.Equal(t, "50.0%", c[0].Percentage())
+
+	mode, blocks, err := ParseBlocks(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, "count", mode)
+	assert.Equal(t, 2, len(blocks))
+}
+
+func TestCovListUnknownHeaders(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	profile := "mode: count\n" +
+		"generator: some-tool v1\n" +
+		fileName + ":32.49,33.13 1 30\n" +
+		"mode: count\n" +
+		fileName + ":42.49,43.13 1 0\n"
+
+	var warnings []string
+	c, err := CovListWithOptions(strings.NewReader(profile), ParseOptions{
+		OnWarning: func(msg string) { warnings = append(warnings, msg) },
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"skip unknown header line: generator: some-tool v1"}, warnings)
+	assert.Equal(t, 2, len(c[0].Blocks))
+
+	_, err = CovListWithOptions(strings.NewReader(profile), ParseOptions{RejectUnknownHeaders: true})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `"generator"`)
+
+	// a repeated mode line must agree
+	_, err = CovList(strings.NewReader("mode: count\n" + fileName + ":32.49,33.13 1 30\nmode: set\n"))
+	assert.Error(t, err)
+	// not a header
+	_, err = CovList(strings.NewReader("mode: count\n" + fileName + ":32.49 1 30\n"))
+	assert.Error(t, err)
+}
+
+func TestCovListHeaderBeforeMode(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	blocks := fileName + ":32.49,33.13 1 30\n" +
+		fileName + ":42.49,43.13 1 0\n"
+	items := []struct {
+		profile    string
+		opts       ParseOptions
+		expectMode string
+		expectErr  bool
+	}{
+		{
+			profile:    "build: abc\nmode: count\n" + blocks,
+			expectMode: "count",
+		},
+		{
+			profile:   "build: abc\nmode: set\n" + blocks,
+			opts:      ParseOptions{RejectUnknownHeaders: true},
+			expectErr: true,
+		},
+		{
+			profile:   "mode: set\nbuild: abc\nmode: count\n" + blocks,
+			expectErr: true,
+		},
+	}
+
+	for _, tc := range items {
+		c, err := CovListWithOptions(strings.NewReader(tc.profile), tc.opts)
+		if tc.expectErr {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expectMode, c[0].Mode)
+		assert.Equal(t, 2, len(c[0].Blocks))
+
+		// the blocks based parsing skips the injected headers the same way
+		mode, parsed, err := ParseBlocks(strings.NewReader(tc.profile))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expectMode, mode)
+		assert.Equal(t, 2, len(parsed))
+
+		a := NewAccumulator(MergeSum)
+		assert.NoError(t, a.Add(strings.NewReader(tc.profile)))
+		assert.Equal(t, tc.expectMode, a.Mode())
+	}
+
+	_, _, err := ParseBlocks(strings.NewReader("mode: set\nbuild: abc\nmode: count\n" + blocks))
+	assert.Error(t, err)
+	_, _, err = ParseBlocks(strings.NewReader("build: abc\n" + blocks))
+	assert.Error(t, err)
+}
+
+func TestCovListEmbedded(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	logs := "2020/06/01 12:00:00 server started\n" +
+		"2020/06/01 12:00:01 dump coverage profile\n" +
+		"mode: count\n" +
+		fileName + ":32.49,33.13 1 30\n" +
+		fileName + ":42.49,43.13 1 0\n" +
+		"2020/06/01 12:00:02 profile dumped\n" +
+		fileName + ":52.49,53.13 1 1\n"
+
+	c, err := CovListWithOptions(strings.NewReader(logs), ParseOptions{Embedded: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(c))
+	assert.Equal(t, "count", c[0].Mode)
+	assert.Equal(t, 2, len(c[0].Blocks))
+	assert.Equal(t, "50.0%", c[0].Percentage())
+
+	// not embedded, the log lines are errors
+	_, err = CovList(strings.NewReader(logs))
+	assert.Error(t, err)
+
+	for _, noProfile := range []string{"", "2020/06/01 12:00:00 server started\n"} {
+		_, err = CovListWithOptions(strings.NewReader(noProfile), ParseOptions{Embedded: true})
+		assert.Error(t, err)
+	}
+}
+
+func TestParseBlocks(t *testing.T) {
+	mainFile := "qiniu.com/kodo/apiserver/server/main.go"
+	svrFile := "qiniu.com/kodo/apiserver/server/svr.go"
+	profile := "mode: count\n" +
+		mainFile + ":42.49,43.13 1 0\n" +
+		svrFile + ":10.1,12.2 2 3\n" +
+		"\n" +
+		mainFile + ":32.49,33.13 1 30\n"
+
+	mode, blocks, err := ParseBlocks(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, "count", mode)
+	assert.Equal(t, []CoverBlock{
+		{FileName: mainFile, StartLine: 42, StartCol: 49, EndLine: 43, EndCol: 13, NumStmt: 1, Count: 0},
+		{FileName: svrFile, StartLine: 10, StartCol: 1, EndLine: 12, EndCol: 2, NumStmt: 2, Count: 3},
+		{FileName: mainFile, StartLine: 32, StartCol: 49, EndLine: 33, EndCol: 13, NumStmt: 1, Count: 30},
+	}, blocks)
+
+	_, _, err = ParseBlocks(strings.NewReader(mainFile + ":42.49,43.13 1 0\n"))
+	assert.Error(t, err)
+}
+
+func TestCovListWithBOM(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	profile := "\xef\xbb\xbfmode: atomic\n" +
+		fileName + ":32.49,33.13 1 30\n" +
+		fileName + ":42.49,43.13 1 0\n"
+
+	mode, blocks, err := ParseBlocks(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, "atomic", mode)
+	assert.Equal(t, 2, len(blocks))
+
+	c, err := CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, "50.0%", c[0].Percentage())
+}
+
+func TestCovListLargeCount(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	// the hit count of a long running atomic profile overflows int32
+	profile := "mode: atomic\n" +
+		fileName + ":32.49,33.13 1 1099511627775\n" +
+		fileName + ":42.49,43.13 1 0\n"
+
+	c, err := CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1<<40-1), c[0].Blocks[0].Count)
+	assert.Equal(t, "50.0%", c[0].Percentage())
+
+	a := NewAccumulator(MergeSum)
+	assert.NoError(t, a.Add(strings.NewReader(profile)))
+	assert.NoError(t, a.Add(strings.NewReader(profile)))
+	var buf bytes.Buffer
+	assert.NoError(t, a.List().WriteProfile(&buf))
+	assert.Contains(t, buf.String(), fileName+":32.49,33.13 1 2199023255550\n")
+
+	_, err = CovList(strings.NewReader("mode: atomic\n" + fileName + ":32.49,33.13 1 99999999999999999999\n"))
+	assert.Error(t, err)
+}
+
+func TestCovListSkipSynthetic(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	profile := "mode: atomic\n" +
+		fileName + ":32.49,33.13 1 30\n" +
+		fileName + ":42.49,43.13 1 0\n" +
+		fileName + ":50.2,50.2 0 0\n" +
+		"qiniu.com/kodo/apiserver/server/http_cover_apis_auto_generated.go:10.1,12.2 2 0\n" +
+		"qiniu.com/kodo/apiserver/server/cache_vars_auto_generated_643131623532.go:10.1,12.2 2 0\n"
+
+	c, err := CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(c))
+
+	c, err = CovListWithOptions(strings.NewReader(profile), ParseOptions{SkipSynthetic: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(c))
+	assert.Equal(t, 2, len(c[0].Blocks))
+	assert.Equal(t, "50.0%", c[0].Percentage())
+}
+
+func TestLineCount(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	items := []struct {
+		profile       string
+		expectTotal   int
+		expectCovered int
+	}{
+		// two statements in one line are counted once
+		{
+			profile: "mode: atomic\n" +
+				fileName + ":32.49,33.13 1 30\n" +
+				fileName + ":33.14,33.30 1 0\n" +
+				fileName + ":42.49,43.13 1 0\n",
+			expectTotal:   4,
+			expectCovered: 2,
+		},
+		{
+			profile: "mode: set\n" +
+				fileName + ":10.1,12.2 3 1\n",
+			expectTotal:   3,
+			expectCovered: 3,
+		},
+	}
+
+	for _, tc := range items {
+		c, err := CovList(strings.NewReader(tc.profile))
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expectTotal, c[0].TotalLineCount())
+		assert.Equal(t, tc.expectCovered, c[0].CoveredLineCount())
+	}
+}
+
+func TestCoveredLines(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	c, err := CovList(strings.NewReader("mode: count\n" +
+		fileName + ":33.14,33.30 1 0\n" +
+		fileName + ":32.49,33.13 2 30\n" +
+		fileName + ":40.1,40.5 0 1\n"))
+	assert.NoError(t, err)
+	lines := c[0].CoveredLines()
+	assert.Equal(t, []LineCoverage{
+		{Line: 32, CoveredStmts: 2, AllStmts: 2, Hits: 30},
+		{Line: 33, CoveredStmts: 2, AllStmts: 3, Hits: 30},
+	}, lines)
+	assert.Equal(t, float32(1), lines[0].Fraction())
+	assert.InDelta(t, 2.0/3, lines[1].Fraction(), 1e-6)
+	assert.Equal(t, float32(0), LineCoverage{}.Fraction())
+	assert.Empty(t, testCoverage().CoveredLines())
+}
+
+func TestLineTotals(t *testing.T) {
+	c, err := CovList(strings.NewReader("mode: count\n" +
+		"example.com/a/a.go:33.14,33.30 1 0\n" +
+		"example.com/a/a.go:32.49,33.13 2 30\n" +
+		"example.com/a/a.go:35.1,36.5 1 0\n" +
+		"example.com/a/a.go:40.1,40.5 0 1\n" +
+		"example.com/a/b.go:1.1,2.5 1 1\n"))
+	assert.NoError(t, err)
+	covered, total := c.LineTotals()
+	assert.Equal(t, 4, covered)
+	assert.Equal(t, 6, total)
+
+	covered, total = c.GroupByPackage().LineTotals()
+	assert.Equal(t, 4, covered)
+	assert.Equal(t, 6, total)
+
+	covered, total = CoverageList{*testCoverage()}.LineTotals()
+	assert.Equal(t, 0, covered)
+	assert.Equal(t, 0, total)
+}
+
+func TestRatioInLineRange(t *testing.T) {
+	c, err := CovList(strings.NewReader("mode: count\n" +
+		"a.go:10.14,12.3 2 1\n" +
+		"a.go:12.3,14.10 1 0\n" +
+		"a.go:20.1,22.2 1 5\n" +
+		"a.go:30.1,30.5 0 1\n"))
+	assert.NoError(t, err)
+	items := []struct {
+		start, end int
+		expect     float32
+		expectErr  error
+	}{
+		{start: 1, end: 100, expect: 0.75},
+		{start: 13, end: 13, expect: 0},
+		{start: 12, end: 20, expect: 0.75},
+		{start: 11, end: 11, expect: 1},
+		{start: 15, end: 19, expectErr: ErrNoStatements},
+		{start: 30, end: 30, expectErr: ErrNoStatements},
+	}
+	for _, tc := range items {
+		ratio, err := c[0].RatioInLineRange(tc.start, tc.end)
+		if tc.expectErr != nil {
+			assert.True(t, errors.Is(err, tc.expectErr), "lines %d-%d", tc.start, tc.end)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, ratio, "lines %d-%d", tc.start, tc.end)
+	}
+
+	_, err = c[0].RatioInLineRange(20, 10)
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrNoStatements))
+}
+
 func TestReadFileToCoverList(t *testing.T) {
 	path := "unknown"
 	_, err := ReadFileToCoverList(path)
@@ -123,6 +601,75 @@ func TestTotalPercentage(t *testing.T) {
 	}
 }
 
+func TestGroupByPackage(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/b/b.go", NCoveredStmts: 10, NAllStmts: 20},
+		Coverage{FileName: "qiniu.com/kodo/a/a.go", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: "qiniu.com/kodo/b/b1.go", NCoveredStmts: 5, NAllStmts: 20},
+	}
+	expect := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/a", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: "qiniu.com/kodo/b", NCoveredStmts: 15, NAllStmts: 40},
+	}
+	assert.Equal(t, expect, list.GroupByPackage())
+}
+
+func TestCoalesce(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: "b", NCoveredStmts: 10, NAllStmts: 30},
+		Coverage{FileName: "a", NCoveredStmts: 5, NAllStmts: 20},
+	}
+	expect := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 20, NAllStmts: 40},
+		Coverage{FileName: "b", NCoveredStmts: 10, NAllStmts: 30},
+	}
+
+	res := list.Coalesce()
+	assert.Equal(t, expect, res)
+	a := res.Map()["a"]
+	assert.Equal(t, "50.0%", a.Percentage())
+	// the original list is untouched
+	assert.Equal(t, 15, list[0].NCoveredStmts)
+}
+
+func TestMaxFileNameLen(t *testing.T) {
+	items := []struct {
+		list   CoverageList
+		expect int
+	}{
+		{list: nil, expect: 0},
+		{list: CoverageList{Coverage{FileName: "a.go"}, Coverage{FileName: "qiniu.com/b.go"}}, expect: 14},
+		{list: CoverageList{Coverage{FileName: "包/a.go"}}, expect: 6},
+	}
+	for _, tc := range items {
+		assert.Equal(t, tc.expect, tc.list.MaxFileNameLen())
+	}
+
+	list := CoverageList{Coverage{FileName: "/home/ci/qiniu.com/b.go"}}
+	assert.Equal(t, 14, list.Redact([]string{"/home/ci/"}, "").MaxFileNameLen())
+}
+
+func TestRedact(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "/home/ci-secret/src/a.go", NCoveredStmts: 1, NAllStmts: 2, Blocks: []CoverBlock{
+			{FileName: "/home/ci-secret/src/a.go", NumStmt: 2, Count: 1},
+		}},
+		Coverage{FileName: "/home/ci/b.go", NCoveredStmts: 1, NAllStmts: 1},
+		Coverage{FileName: "qiniu.com/kodo/c.go", NCoveredStmts: 1, NAllStmts: 1},
+	}
+
+	res := list.Redact([]string{"/home/ci", "/home/ci-secret/src", ""}, "<root>")
+	assert.Equal(t, "<root>/a.go", res[0].FileName)
+	assert.Equal(t, "<root>/a.go", res[0].Blocks[0].FileName)
+	assert.Equal(t, "<root>/b.go", res[1].FileName)
+	assert.Equal(t, "qiniu.com/kodo/c.go", res[2].FileName)
+	assert.Equal(t, "50.0%", res[0].Percentage())
+	// the original list is untouched
+	assert.Equal(t, "/home/ci-secret/src/a.go", list[0].FileName)
+	assert.Equal(t, "/home/ci-secret/src/a.go", list[0].Blocks[0].FileName)
+}
+
 func TestBuildCoverCmd(t *testing.T) {
 	var testCases = []struct {
 		name      string
@@ -234,6 +781,63 @@ func TestDeclareCoverVars(t *testing.T) {
 
 }
 
+func TestCheckOverlappingFiles(t *testing.T) {
+	pkgs := map[string]*Package{
+		"example/a": {Dir: "/go/src/example/a", ImportPath: "example/a", GoFiles: []string{"a.go"}},
+		"example/b": {Dir: "/go/src/example/b", ImportPath: "example/b", GoFiles: []string{"a.go"}, CgoFiles: []string{"c.go"}},
+	}
+	assert.NoError(t, checkOverlappingFiles(pkgs))
+
+	pkgs["vendor/example/b"] = &Package{Dir: "/go/src/example/b/", ImportPath: "vendor/example/b", CgoFiles: []string{"c.go"}}
+	err := checkOverlappingFiles(pkgs)
+	assert.EqualError(t, err, "file "+filepath.Join("/go/src/example/b", "c.go")+" is instrumented under both example/b and vendor/example/b")
+}
+
+func TestOrderedCoverVars(t *testing.T) {
+	pkg := &Package{
+		Dir:        "/go/src/goc/cmd/example-project/a/b",
+		GoFiles:    []string{"printf.go", "printf1.go"},
+		CgoFiles:   []string{"cgo.go"},
+		ImportPath: "example/a/b",
+	}
+	expect := []SourceFileVar{
+		{File: "printf.go", Var: &FileVar{File: "example/a/b/printf.go", Var: "GoCover_0_326535623364613565313464"}},
+		{File: "printf1.go", Var: &FileVar{File: "example/a/b/printf1.go", Var: "GoCover_1_326535623364613565313464"}},
+		{File: "cgo.go", Var: &FileVar{File: "example/a/b/cgo.go", Var: "GoCover_2_326535623364613565313464"}},
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, expect, OrderedCoverVars(pkg))
+	}
+}
+
+func TestUninstrumentedFiles(t *testing.T) {
+	pkgs := map[string]*Package{
+		"example/a": {ImportPath: "example/a", GoFiles: []string{"a.go", "types.go"}},
+		"example/b": {ImportPath: "example/b", GoFiles: []string{"b.go"}, CgoFiles: []string{"cgo.go"}},
+		"example/c": {ImportPath: "example/c"},
+	}
+	items := []struct {
+		list   CoverageList
+		expect []string
+	}{
+		{
+			list:   CoverageList{{FileName: "example/a/a.go"}, {FileName: "example/b/cgo.go"}},
+			expect: nil,
+		},
+		{
+			list:   CoverageList{{FileName: "example/a/a.go"}},
+			expect: []string{"example/b/b.go", "example/b/cgo.go"},
+		},
+		{
+			list:   nil,
+			expect: []string{"example/a/a.go", "example/a/types.go", "example/b/b.go", "example/b/cgo.go"},
+		},
+	}
+	for _, tc := range items {
+		assert.Equal(t, tc.expect, UninstrumentedFiles(pkgs, tc.list))
+	}
+}
+
 func TestGetInternalParent(t *testing.T) {
 	var tcs = []struct {
 		ImportPath     string
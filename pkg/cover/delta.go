@@ -134,3 +134,204 @@ func (c *DeltaCov) GetLineCovLink() string {
 func (c *DeltaCov) SetLineCovLink(link string) {
 	c.LineCovLink = link
 }
+
+// Regression is a file whose coverage dropped against the base
+type Regression struct {
+	File      string   `json:"file"`
+	Covered   int      `json:"covered"`
+	Total     int      `json:"total"`
+	BaseRatio *float32 `json:"base_ratio"` // null for a file not in the base
+	NewRatio  float32  `json:"new_ratio"`
+}
+
+// Regressions returns the files whose ratio dropped by more than epsilon against base,
+// sorted by file name. Files without any statement are skipped, and the files not in
+// base with a 0% coverage are included only if includeNewZero is true.
+func (g CoverageList) Regressions(base CoverageList, epsilon float32, includeNewZero bool) []Regression {
+	baseMap := base.Map()
+	var res []Regression
+	for _, n := range g {
+		newRatio, err := n.Ratio()
+		if err != nil {
+			continue
+		}
+		r := Regression{File: n.FileName, Covered: n.NCoveredStmts, Total: n.NAllStmts, NewRatio: newRatio}
+		b, ok := baseMap[n.FileName]
+		if !ok {
+			if includeNewZero && n.NCoveredStmts == 0 {
+				res = append(res, r)
+			}
+			continue
+		}
+		baseRatio, err := b.Ratio()
+		if err != nil || baseRatio-newRatio <= epsilon {
+			continue
+		}
+		r.BaseRatio = &baseRatio
+		res = append(res, r)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].File < res[j].File
+	})
+	return res
+}
+
+// NewlyFullyCovered returns the files which are covered below 100% in base and exactly 100% in new,
+// sorted by file name
+func NewlyFullyCovered(newList CoverageList, baseList CoverageList) []string {
+	return fullCoverageTransitions(newList, baseList, false)
+}
+
+// LostFullCoverage returns the files which are covered 100% in base and below 100% in new,
+// sorted by file name
+func LostFullCoverage(newList CoverageList, baseList CoverageList) []string {
+	return fullCoverageTransitions(newList, baseList, true)
+}
+
+func fullCoverageTransitions(newList CoverageList, baseList CoverageList, lost bool) []string {
+	baseMap := baseList.Map()
+	var files []string
+	for _, n := range newList {
+		b, ok := baseMap[n.FileName]
+		if !ok || n.NAllStmts == 0 || b.NAllStmts == 0 {
+			continue
+		}
+		newFull := n.NCoveredStmts == n.NAllStmts
+		baseFull := b.NCoveredStmts == b.NAllStmts
+		if (lost && baseFull && !newFull) || (!lost && !baseFull && newFull) {
+			files = append(files, n.FileName)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// PackageDelta is the coverage change of a package
+type PackageDelta struct {
+	Package   string   `json:"package"`
+	BaseRatio *float32 `json:"base_ratio"` // null for a package without statement in the base
+	NewRatio  *float32 `json:"new_ratio"`  // null for a package without statement in the new
+	Delta     float32  `json:"delta"`
+	// Contribution is the change of the package's covered statements weighted by its
+	// share of all statements, i.e. covered/all of new minus the one of base.
+	// The contributions of all packages sum to the total delta.
+	Contribution float32 `json:"contribution"`
+}
+
+// PackageDeltas returns the coverage change per package sorted by contribution to the
+// total delta, the packages which dropped the total most come first
+func PackageDeltas(newList, baseList *CoverageList) []PackageDelta {
+	var newPkgs, basePkgs CoverageList
+	if newList != nil {
+		newPkgs = newList.GroupByPackage()
+	}
+	if baseList != nil {
+		basePkgs = baseList.GroupByPackage()
+	}
+	_, newAll := newPkgs.totalStmts()
+	_, baseAll := basePkgs.totalStmts()
+	newMap, baseMap := newPkgs.Map(), basePkgs.Map()
+
+	var pkgs []string
+	for _, p := range newPkgs {
+		pkgs = append(pkgs, p.Name())
+	}
+	for _, p := range basePkgs {
+		if _, ok := newMap[p.Name()]; !ok {
+			pkgs = append(pkgs, p.Name())
+		}
+	}
+
+	res := make([]PackageDelta, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		n, b := newMap[pkg], baseMap[pkg]
+		d := PackageDelta{Package: pkg, Delta: Delta(n, b)}
+		if ratio, err := n.Ratio(); err == nil {
+			d.NewRatio = &ratio
+		}
+		if ratio, err := b.Ratio(); err == nil {
+			d.BaseRatio = &ratio
+		}
+		d.Contribution = contribution(n, b, newAll, baseAll)
+		res = append(res, d)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Contribution != res[j].Contribution {
+			return res[i].Contribution < res[j].Contribution
+		}
+		return res[i].Package < res[j].Package
+	})
+	return res
+}
+
+// contribution returns the share of n in the covered statements of all newAll statements
+// minus the one of b in baseAll, which sum to the total delta over the files or packages
+func contribution(n, b Coverage, newAll, baseAll int) float32 {
+	var c float32
+	if newAll > 0 {
+		c += float32(n.NCoveredStmts) / float32(newAll)
+	}
+	if baseAll > 0 {
+		c -= float32(b.NCoveredStmts) / float32(baseAll)
+	}
+	return c
+}
+
+// ExplainDrop returns the fewest files whose contributions, like the ones of PackageDeltas,
+// explain at least fraction of the drop of the total ratio of newList against baseList,
+// the files which dropped it most first. A file removed from newList is returned as it is
+// in baseList. A nil list is empty. Nothing is returned if the total ratio did not drop.
+func ExplainDrop(newList, baseList *CoverageList, fraction float32) []Coverage {
+	var newFiles, baseFiles CoverageList
+	if newList != nil {
+		newFiles = *newList
+	}
+	if baseList != nil {
+		baseFiles = *baseList
+	}
+	_, newAll := newFiles.totalStmts()
+	_, baseAll := baseFiles.totalStmts()
+	newMap, baseMap := newFiles.Map(), baseFiles.Map()
+
+	type fileContribution struct {
+		cov          Coverage
+		contribution float32
+	}
+	var files []fileContribution
+	var drop float32
+	add := func(cov, n, b Coverage) {
+		c := contribution(n, b, newAll, baseAll)
+		drop += c
+		if c < 0 {
+			files = append(files, fileContribution{cov: cov, contribution: c})
+		}
+	}
+	for _, n := range newFiles {
+		add(n, n, baseMap[n.Name()])
+	}
+	for _, b := range baseFiles {
+		if _, ok := newMap[b.Name()]; !ok {
+			add(b, Coverage{}, b)
+		}
+	}
+	if drop >= 0 {
+		return nil
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].contribution != files[j].contribution {
+			return files[i].contribution < files[j].contribution
+		}
+		return files[i].cov.Name() < files[j].cov.Name()
+	})
+	var res []Coverage
+	var explained float32
+	for _, f := range files {
+		if explained <= fraction*drop {
+			break
+		}
+		res = append(res, f.cov)
+		explained += f.contribution
+	}
+	return res
+}
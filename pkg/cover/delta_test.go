@@ -131,3 +131,129 @@ func TestMapAndSort(t *testing.T) {
 	}
 
 }
+
+func TestRegressions(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "b", NCoveredStmts: 10, NAllStmts: 20},
+		Coverage{FileName: "a", NCoveredStmts: 14, NAllStmts: 20},
+		Coverage{FileName: "c", NCoveredStmts: 19, NAllStmts: 20},
+		Coverage{FileName: "d", NCoveredStmts: 0, NAllStmts: 20},
+		Coverage{FileName: "e", NCoveredStmts: 0, NAllStmts: 0},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: "b", NCoveredStmts: 20, NAllStmts: 20},
+		Coverage{FileName: "c", NCoveredStmts: 18, NAllStmts: 20},
+		Coverage{FileName: "e", NCoveredStmts: 1, NAllStmts: 2},
+	}
+
+	var files []string
+	for _, r := range newList.Regressions(baseList, 0.01, false) {
+		files = append(files, r.File)
+	}
+	assert.Equal(t, []string{"a", "b"}, files)
+
+	res := newList.Regressions(baseList, 0.1, true)
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, "b", res[0].File)
+	assert.Equal(t, float32(1), *res[0].BaseRatio)
+	assert.Equal(t, float32(0.5), res[0].NewRatio)
+	assert.Equal(t, "d", res[1].File)
+	assert.Nil(t, res[1].BaseRatio)
+}
+
+func TestFullCoverageTransitions(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "b", NCoveredStmts: 20, NAllStmts: 20},
+		Coverage{FileName: "a", NCoveredStmts: 20, NAllStmts: 20},
+		Coverage{FileName: "c", NCoveredStmts: 19, NAllStmts: 20},
+		Coverage{FileName: "d", NCoveredStmts: 20, NAllStmts: 20},
+		Coverage{FileName: "e", NCoveredStmts: 20, NAllStmts: 20},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: "b", NCoveredStmts: 0, NAllStmts: 10},
+		Coverage{FileName: "c", NCoveredStmts: 18, NAllStmts: 18},
+		Coverage{FileName: "d", NCoveredStmts: 20, NAllStmts: 20},
+	}
+	assert.Equal(t, []string{"a", "b"}, NewlyFullyCovered(newList, baseList))
+	assert.Equal(t, []string{"c"}, LostFullCoverage(newList, baseList))
+}
+
+func TestPackageDeltas(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "a/x.go", NCoveredStmts: 2, NAllStmts: 10},
+		Coverage{FileName: "a/y.go", NCoveredStmts: 3, NAllStmts: 10},
+		Coverage{FileName: "b/x.go", NCoveredStmts: 18, NAllStmts: 20},
+		Coverage{FileName: "c/x.go", NCoveredStmts: 0, NAllStmts: 0},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "a/x.go", NCoveredStmts: 8, NAllStmts: 10},
+		Coverage{FileName: "a/y.go", NCoveredStmts: 7, NAllStmts: 10},
+		Coverage{FileName: "b/x.go", NCoveredStmts: 16, NAllStmts: 20},
+		Coverage{FileName: "d/x.go", NCoveredStmts: 5, NAllStmts: 10},
+	}
+
+	res := PackageDeltas(&newList, &baseList)
+	var pkgs []string
+	var sum float32
+	for _, d := range res {
+		pkgs = append(pkgs, d.Package)
+		sum += d.Contribution
+	}
+	assert.Equal(t, []string{"a", "d", "c", "b"}, pkgs)
+	assert.InDelta(t, TotalDelta(newList, baseList), sum, 1e-6)
+
+	a := res[0]
+	assert.InDelta(t, 0.75, *a.BaseRatio, 1e-6)
+	assert.InDelta(t, 0.25, *a.NewRatio, 1e-6)
+	assert.InDelta(t, -0.5, a.Delta, 1e-6)
+	assert.InDelta(t, 5.0/40-15.0/50, a.Contribution, 1e-6)
+	assert.Nil(t, res[1].NewRatio)
+	assert.Nil(t, res[2].NewRatio)
+	assert.Nil(t, res[2].BaseRatio)
+
+	assert.Equal(t, 3, len(PackageDeltas(&newList, nil)))
+}
+
+func TestExplainDrop(t *testing.T) {
+	baseList := CoverageList{
+		Coverage{FileName: "a.go", NCoveredStmts: 10, NAllStmts: 10},
+		Coverage{FileName: "b.go", NCoveredStmts: 10, NAllStmts: 10},
+		Coverage{FileName: "c.go", NCoveredStmts: 5, NAllStmts: 10},
+		Coverage{FileName: "d.go", NCoveredStmts: 10, NAllStmts: 10},
+	}
+	newList := CoverageList{
+		Coverage{FileName: "a.go", NCoveredStmts: 5, NAllStmts: 10},
+		Coverage{FileName: "b.go", NCoveredStmts: 9, NAllStmts: 10},
+		Coverage{FileName: "c.go", NCoveredStmts: 6, NAllStmts: 10},
+		Coverage{FileName: "e.go", NCoveredStmts: 0, NAllStmts: 10},
+	}
+	items := []struct {
+		fraction float32
+		expect   []string
+	}{
+		{fraction: 0.5, expect: []string{"d.go"}},
+		{fraction: 0.9, expect: []string{"d.go", "a.go"}},
+		{fraction: 0, expect: nil},
+	}
+	for _, tc := range items {
+		var files []string
+		for _, c := range ExplainDrop(&newList, &baseList, tc.fraction) {
+			files = append(files, c.Name())
+		}
+		assert.Equal(t, tc.expect, files, "fraction %v", tc.fraction)
+	}
+
+	res := ExplainDrop(&newList, &baseList, 0.9)
+	assert.Equal(t, 10, res[0].NCoveredStmts, "a removed file is returned as in the base")
+	assert.Empty(t, ExplainDrop(&baseList, &newList, 0.9))
+
+	// a nil list is empty, so every base file explains the drop to nothing
+	assert.Empty(t, ExplainDrop(&newList, nil, 0.9))
+	assert.Empty(t, ExplainDrop(nil, nil, 0.9))
+	files := ExplainDrop(nil, &baseList, 0.5)
+	if assert.Equal(t, 2, len(files)) {
+		assert.Equal(t, "a.go", files[0].Name())
+	}
+}
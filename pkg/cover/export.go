@@ -0,0 +1,461 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// coverageJSON is the stable json representation of a Coverage
+type coverageJSON struct {
+	File       string   `json:"file"`
+	Covered    int      `json:"covered"`
+	Total      int      `json:"total"`
+	Ratio      *float32 `json:"ratio"` // null when the file has no statement
+	Percentage string   `json:"percentage"`
+}
+
+func (c Coverage) toJSON() coverageJSON {
+	res := coverageJSON{
+		File:    c.FileName,
+		Covered: c.NCoveredStmts,
+		Total:   c.NAllStmts,
+	}
+	ratio, err := c.Ratio()
+	if err == nil {
+		res.Ratio = &ratio
+	}
+	// the global formatter is for the reports, the json stays stable
+	res.Percentage = DefaultPercentageFormatter(ratio, err == nil)
+	return res
+}
+
+// MarshalJSON implements json.Marshaler with field names independent of the struct
+func (c Coverage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.toJSON())
+}
+
+// UnmarshalJSON implements json.Unmarshaler for the output of MarshalJSON, the ratio and
+// percentage fields are derived from the counts so they are ignored
+func (c *Coverage) UnmarshalJSON(data []byte) error {
+	var res coverageJSON
+	if err := json.Unmarshal(data, &res); err != nil {
+		return err
+	}
+	*c = Coverage{FileName: res.File, NCoveredStmts: res.Covered, NAllStmts: res.Total}
+	return nil
+}
+
+// TrendGlyphs are the glyphs of the trend column of the text report
+type TrendGlyphs struct {
+	Up, Down, Flat, New string
+}
+
+var (
+	// DefaultTrendGlyphs are the unicode trend glyphs
+	DefaultTrendGlyphs = TrendGlyphs{Up: "↑", Down: "↓", Flat: "→", New: "✦"}
+	// ASCIITrendGlyphs are the trend glyphs for the terminals without unicode
+	ASCIITrendGlyphs = TrendGlyphs{Up: "^", Down: "v", Flat: "=", New: "+"}
+)
+
+// TextOptions customizes the text report of WriteTextWithOptions
+type TextOptions struct {
+	// Base, if not nil, adds a column of the trend of each file against it
+	Base CoverageList
+	// Glyphs of the trend column, DefaultTrendGlyphs if nil
+	Glyphs *TrendGlyphs
+	// Threshold, if not nil, adds a PASS/FAIL column of each file against it, SKIP for
+	// files without statements, and a final overall status line
+	Threshold *float32
+}
+
+// WriteText writes the coverage as a text table sorted by file name, with a right-aligned
+// percentage column 7 characters wide, the file column and a final total line, e.g.
+//
+//	// Output:
+//	  50.0%  qiniu.com/kodo/apiserver/server/main.go
+//	 100.0%  qiniu.com/kodo/apiserver/server/svr.go
+//	  66.7%  Total
+func (g CoverageList) WriteText(w io.Writer) error {
+	return g.WriteTextWithOptions(w, TextOptions{})
+}
+
+// WriteTextWithOptions writes the text report of WriteText customized by opts. With a base
+// list a trend glyph follows each percentage, e.g.
+//
+//	// Output:
+//	  50.0% ↓  qiniu.com/kodo/apiserver/server/main.go
+//	 100.0% ✦  qiniu.com/kodo/apiserver/server/svr.go
+//	  66.7% ↑  Total
+//
+// With a threshold of 60% the files get a status column, followed by an overall status:
+//
+//	    N/A  qiniu.com/kodo/apiserver/server/empty.go  SKIP
+//	  50.0%  qiniu.com/kodo/apiserver/server/main.go   FAIL
+//	 100.0%  qiniu.com/kodo/apiserver/server/svr.go    PASS
+//	  66.7%  Total                                     PASS
+//	FAIL: 1 of 2 files below 60.0%
+func (g CoverageList) WriteTextWithOptions(w io.Writer, opts TextOptions) error {
+	sorted := append(CoverageList(nil), g...)
+	sorted.Sort()
+	var baseMap map[string]Coverage
+	if opts.Base != nil {
+		baseMap = opts.Base.Map()
+	}
+	nameWidth := 0
+	if opts.Threshold != nil {
+		nameWidth = maxInt(g.MaxFileNameLen(), len("Total"))
+	}
+	failed, checked := 0, 0
+	for _, c := range sorted {
+		trend := ""
+		if baseMap != nil {
+			b, ok := baseMap[c.Name()]
+			trend = opts.trendGlyph(Delta(c, b), ok)
+		}
+		ratio, err := c.Ratio()
+		status := opts.status(ratio, err == nil)
+		if status == statusFail {
+			failed++
+		}
+		if status != statusSkip {
+			checked++
+		}
+		if err := writeTextRow(w, c.Percentage(), trend, c.Name(), nameWidth, status); err != nil {
+			return err
+		}
+	}
+	trend := ""
+	if baseMap != nil {
+		trend = opts.trendGlyph(TotalDelta(g, opts.Base), true)
+	}
+	ratio, err := g.TotalRatio()
+	if err := writeTextRow(w, g.TotalPercentage(), trend, "Total", nameWidth, opts.status(ratio, err == nil)); err != nil {
+		return err
+	}
+	if opts.Threshold == nil {
+		return nil
+	}
+	threshold := PercentStr(*opts.Threshold)
+	switch {
+	case checked == 0:
+		_, err = fmt.Fprintf(w, "%s: no files with statements\n", statusSkip)
+	case failed > 0:
+		_, err = fmt.Fprintf(w, "%s: %d of %d files below %s\n", statusFail, failed, checked, threshold)
+	default:
+		_, err = fmt.Fprintf(w, "%s: all %d files at or above %s\n", statusPass, checked, threshold)
+	}
+	return err
+}
+
+const (
+	statusPass = "PASS"
+	statusFail = "FAIL"
+	statusSkip = "SKIP"
+)
+
+// writeTextRow writes a row of the text report, with the status column after the file
+// name padded to nameWidth if status is not empty
+func writeTextRow(w io.Writer, percentage, trend, name string, nameWidth int, status string) error {
+	var err error
+	if status == "" {
+		_, err = fmt.Fprintf(w, "%7s%s  %s\n", percentage, trend, name)
+	} else {
+		_, err = fmt.Fprintf(w, "%7s%s  %-*s  %s\n", percentage, trend, nameWidth, name, status)
+	}
+	return err
+}
+
+// status returns the status column of a ratio, empty without a threshold
+func (opts TextOptions) status(ratio float32, valid bool) string {
+	switch {
+	case opts.Threshold == nil:
+		return ""
+	case !valid:
+		return statusSkip
+	case ratio < *opts.Threshold:
+		return statusFail
+	default:
+		return statusPass
+	}
+}
+
+// trendGlyph returns the trend column, including its leading separator
+func (opts TextOptions) trendGlyph(delta float32, inBase bool) string {
+	glyphs := opts.Glyphs
+	if glyphs == nil {
+		glyphs = &DefaultTrendGlyphs
+	}
+	switch {
+	case !inBase:
+		return " " + glyphs.New
+	case delta > 0:
+		return " " + glyphs.Up
+	case delta < 0:
+		return " " + glyphs.Down
+	default:
+		return " " + glyphs.Flat
+	}
+}
+
+// sparkGlyphs are the glyphs of a sparkline from the lowest to the highest value
+var sparkGlyphs = []rune("▁▂▃▄▅▆▇█")
+
+// Sparkline renders the series of ratios, e.g. the total ratios of a coverage history, as a
+// line of block glyphs scaled from the min to the max of the series, like "▂▃▅▆█". A flat
+// series is drawn at mid height and an empty one is the empty string.
+func Sparkline(ratios []float32) string {
+	if len(ratios) == 0 {
+		return ""
+	}
+	min, max := ratios[0], ratios[0]
+	for _, r := range ratios {
+		if r < min {
+			min = r
+		}
+		if r > max {
+			max = r
+		}
+	}
+	line := make([]rune, len(ratios))
+	for i, r := range ratios {
+		level := len(sparkGlyphs) / 2
+		if max > min {
+			level = int((r-min)/(max-min)*float32(len(sparkGlyphs)-1) + 0.5)
+		}
+		line[i] = sparkGlyphs[level]
+	}
+	return string(line)
+}
+
+// WriteProfile writes the retained blocks of the list as a coverage profile,
+// which `go tool cover` can read
+func (g CoverageList) WriteProfile(w io.Writer) error {
+	return g.WriteProfileFiltered(w, func(CoverBlock) bool { return true })
+}
+
+// WriteProfileFiltered writes the retained blocks of the list for which predicate returns true
+// as a coverage profile, e.g. a predicate selecting Count == 0 produces an uncovered-only profile.
+// The mode header is the one the list is converted from, "set" if unknown.
+func (g CoverageList) WriteProfileFiltered(w io.Writer, predicate func(CoverBlock) bool) error {
+	mode, err := g.mode()
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "mode: %s\n", mode)
+	for _, c := range g {
+		for _, b := range c.Blocks {
+			if !predicate(b) {
+				continue
+			}
+			fmt.Fprintf(bw, "%s:%d.%d,%d.%d %d %d\n", b.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+		}
+	}
+	return bw.Flush()
+}
+
+// WriteVetStyle writes a line like go vet per uncovered block of the retained blocks,
+// i.e. "file:line:col: not covered", e.g. for the problem matchers of editors and CI.
+// The blocks without statements are skipped.
+func (g CoverageList) WriteVetStyle(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, c := range g {
+		for _, b := range c.Blocks {
+			if b.Count == 0 && b.NumStmt > 0 {
+				fmt.Fprintf(bw, "%s:%d:%d: not covered\n", b.FileName, b.StartLine, b.StartCol)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// metricNameRegexp matches a valid metric name prefix of the OpenMetrics text format
+var metricNameRegexp = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+// WriteOpenMetrics writes the ratios of the list in the OpenMetrics text format: the gauge
+// <namespace>_file_coverage_ratio with a file label per file with statements and the gauge
+// <namespace>_coverage_ratio of the total, each with its TYPE, UNIT and HELP lines, then
+// the # EOF marker required by strict scrapers. An empty namespace names them without the
+// prefix. Being gauges, they carry no exemplars.
+func (g CoverageList) WriteOpenMetrics(w io.Writer, namespace string) error {
+	prefix := ""
+	if namespace != "" {
+		if !metricNameRegexp.MatchString(namespace) {
+			return fmt.Errorf("bad metric namespace %q", namespace)
+		}
+		prefix = namespace + "_"
+	}
+
+	bw := bufio.NewWriter(w)
+	name := prefix + "file_coverage_ratio"
+	writeMetricFamily(bw, name, "Statement coverage ratio of a file.")
+	for i := range g {
+		if ratio, err := g[i].Ratio(); err == nil {
+			fmt.Fprintf(bw, "%s{file=\"%s\"} %s\n", name, escapeLabelValue(g[i].Name()), metricValue(ratio))
+		}
+	}
+	name = prefix + "coverage_ratio"
+	writeMetricFamily(bw, name, "Total statement coverage ratio.")
+	if ratio, err := g.TotalRatio(); err == nil {
+		fmt.Fprintf(bw, "%s %s\n", name, metricValue(ratio))
+	}
+	fmt.Fprint(bw, "# EOF\n")
+	return bw.Flush()
+}
+
+// writeMetricFamily writes the metadata of a ratio gauge
+func writeMetricFamily(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# TYPE %s gauge\n# UNIT %s ratio\n# HELP %s %s\n", name, name, name, help)
+}
+
+func metricValue(ratio float32) string {
+	return strconv.FormatFloat(float64(ratio), 'g', -1, 32)
+}
+
+// escapeLabelValue escapes a label value of the OpenMetrics text format
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// SplitByPackage writes one profile per package of the profile r into outDir, which is
+// created if needed, e.g. to store the profiles of a coverage center per package. Each
+// profile has the mode header of r and is named by PackageProfileName.
+func SplitByPackage(r io.Reader, outDir string) error {
+	mode, blocks, err := ParseBlocks(r)
+	if err != nil {
+		return err
+	}
+	var pkgs []string
+	byPkg := make(map[string][]CoverBlock)
+	for _, b := range blocks {
+		pkg := path.Dir(filepath.ToSlash(b.FileName))
+		if _, ok := byPkg[pkg]; !ok {
+			pkgs = append(pkgs, pkg)
+		}
+		byPkg[pkg] = append(byPkg[pkg], b)
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return err
+	}
+	for _, pkg := range pkgs {
+		if err := writeBlocksProfile(filepath.Join(outDir, PackageProfileName(pkg)), mode, byPkg[pkg]); err != nil {
+			return fmt.Errorf("write profile of package %s: %v", pkg, err)
+		}
+	}
+	return nil
+}
+
+// PackageProfileName returns the file name of the profile of a package written by
+// SplitByPackage: the import path with the characters other than letters, digits,
+// '.', '_' and '-' percent-encoded, so that it is a single safe path element and
+// distinct packages never share a name, e.g. "qiniu.com%2Fkodo%2Fapiserver.cov"
+func PackageProfileName(pkg string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pkg); i++ {
+		c := pkg[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '.' || c == '_' || c == '-' {
+			sb.WriteByte(c)
+		} else {
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	sb.WriteString(".cov")
+	return sb.String()
+}
+
+func writeBlocksProfile(name string, mode string, blocks []CoverBlock) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	fmt.Fprintf(bw, "mode: %s\n", mode)
+	for _, b := range blocks {
+		fmt.Fprintf(bw, "%s:%d.%d,%d.%d %d %d\n", b.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mode returns the common mode of the list
+func (g CoverageList) mode() (string, error) {
+	mode := ""
+	for _, c := range g {
+		if c.Mode == "" {
+			continue
+		}
+		if mode != "" && mode != c.Mode {
+			return "", fmt.Errorf("mode mismatch: %s vs %s", mode, c.Mode)
+		}
+		mode = c.Mode
+	}
+	if mode == "" {
+		mode = "set"
+	}
+	return mode, nil
+}
+
+// packageJSON is the stable json representation of the coverage of a package
+type packageJSON struct {
+	Package string   `json:"package"`
+	Covered int      `json:"covered"`
+	Total   int      `json:"total"`
+	Ratio   *float32 `json:"ratio"` // null when the package has no statement
+}
+
+// WritePackageJSON writes a json array of the coverage per package like
+// [{"package": "example.com/foo", "covered": 8, "total": 10, "ratio": 0.8}],
+// sorted by package.
+func (g CoverageList) WritePackageJSON(w io.Writer) error {
+	pkgs := g.GroupByPackage()
+	res := make([]packageJSON, 0, len(pkgs))
+	for _, c := range pkgs {
+		p := packageJSON{Package: c.FileName, Covered: c.NCoveredStmts, Total: c.NAllStmts}
+		if ratio, err := c.Ratio(); err == nil {
+			p.Ratio = &ratio
+		}
+		res = append(res, p)
+	}
+	return json.NewEncoder(w).Encode(res)
+}
+
+// WriteNDJSON writes one json object per file, one per line, with the field names of
+// Coverage.MarshalJSON. It streams without building a json array.
+func (g CoverageList) WriteNDJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, c := range g {
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
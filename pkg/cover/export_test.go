@@ -0,0 +1,324 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoverageMarshalJSON(t *testing.T) {
+	items := []struct {
+		cov    Coverage
+		expect string
+	}{
+		{
+			cov:    Coverage{FileName: "a.go", NCoveredStmts: 15, NAllStmts: 20},
+			expect: `{"file":"a.go","covered":15,"total":20,"ratio":0.75,"percentage":"75.0%"}`,
+		},
+		{
+			cov:    Coverage{FileName: "b.go", NCoveredStmts: 0, NAllStmts: 0},
+			expect: `{"file":"b.go","covered":0,"total":0,"ratio":null,"percentage":"N/A"}`,
+		},
+	}
+
+	for _, tc := range items {
+		out, err := json.Marshal(tc.cov)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, string(out))
+
+		out, err = json.Marshal(&tc.cov)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, string(out))
+
+		var cov Coverage
+		assert.NoError(t, json.Unmarshal(out, &cov))
+		assert.Equal(t, tc.cov, cov)
+	}
+
+	// the json does not follow the formatter of the reports
+	SetPercentageFormatter(func(ratio float32, valid bool) string { return "custom" })
+	defer SetPercentageFormatter(nil)
+	out, err := json.Marshal(items[0].cov)
+	assert.NoError(t, err)
+	assert.Equal(t, items[0].expect, string(out))
+
+	var list CoverageList
+	assert.NoError(t, json.Unmarshal([]byte("["+items[0].expect+","+items[1].expect+"]"), &list))
+	assert.Equal(t, CoverageList{items[0].cov, items[1].cov}, list)
+}
+
+func TestWriteText(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/svr.go", NCoveredStmts: 1, NAllStmts: 1},
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/main.go", NCoveredStmts: 1, NAllStmts: 2},
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/empty.go", NCoveredStmts: 0, NAllStmts: 0},
+	}
+	expect := "    N/A  qiniu.com/kodo/apiserver/server/empty.go\n" +
+		"  50.0%  qiniu.com/kodo/apiserver/server/main.go\n" +
+		" 100.0%  qiniu.com/kodo/apiserver/server/svr.go\n" +
+		"  66.7%  Total\n"
+
+	var buf bytes.Buffer
+	assert.NoError(t, list.WriteText(&buf))
+	assert.Equal(t, expect, buf.String())
+	// the list itself is not sorted
+	assert.Equal(t, "qiniu.com/kodo/apiserver/server/svr.go", list[0].FileName)
+}
+
+func TestWriteTextTrend(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/svr.go", NCoveredStmts: 1, NAllStmts: 1},
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/main.go", NCoveredStmts: 1, NAllStmts: 2},
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/flat.go", NCoveredStmts: 1, NAllStmts: 4},
+	}
+	base := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/main.go", NCoveredStmts: 2, NAllStmts: 2},
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/flat.go", NCoveredStmts: 2, NAllStmts: 8},
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/removed.go", NCoveredStmts: 0, NAllStmts: 10},
+	}
+	items := []struct {
+		opts   TextOptions
+		expect string
+	}{
+		{
+			opts: TextOptions{Base: base},
+			expect: "  25.0% →  qiniu.com/kodo/apiserver/server/flat.go\n" +
+				"  50.0% ↓  qiniu.com/kodo/apiserver/server/main.go\n" +
+				" 100.0% ✦  qiniu.com/kodo/apiserver/server/svr.go\n" +
+				"  42.9% ↑  Total\n",
+		},
+		{
+			opts: TextOptions{Base: base, Glyphs: &ASCIITrendGlyphs},
+			expect: "  25.0% =  qiniu.com/kodo/apiserver/server/flat.go\n" +
+				"  50.0% v  qiniu.com/kodo/apiserver/server/main.go\n" +
+				" 100.0% +  qiniu.com/kodo/apiserver/server/svr.go\n" +
+				"  42.9% ^  Total\n",
+		},
+	}
+	for _, tc := range items {
+		var buf bytes.Buffer
+		assert.NoError(t, list.WriteTextWithOptions(&buf, tc.opts))
+		assert.Equal(t, tc.expect, buf.String())
+	}
+}
+
+func TestWriteTextThreshold(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/svr.go", NCoveredStmts: 1, NAllStmts: 1},
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/main.go", NCoveredStmts: 1, NAllStmts: 2},
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/empty.go", NCoveredStmts: 0, NAllStmts: 0},
+	}
+	items := []struct {
+		list      CoverageList
+		threshold float32
+		expect    string
+	}{
+		{
+			list:      list,
+			threshold: 0.6,
+			expect: "    N/A  qiniu.com/kodo/apiserver/server/empty.go  SKIP\n" +
+				"  50.0%  qiniu.com/kodo/apiserver/server/main.go   FAIL\n" +
+				" 100.0%  qiniu.com/kodo/apiserver/server/svr.go    PASS\n" +
+				"  66.7%  Total                                     PASS\n" +
+				"FAIL: 1 of 2 files below 60.0%\n",
+		},
+		{
+			list:      list,
+			threshold: 0.5,
+			expect: "    N/A  qiniu.com/kodo/apiserver/server/empty.go  SKIP\n" +
+				"  50.0%  qiniu.com/kodo/apiserver/server/main.go   PASS\n" +
+				" 100.0%  qiniu.com/kodo/apiserver/server/svr.go    PASS\n" +
+				"  66.7%  Total                                     PASS\n" +
+				"PASS: all 2 files at or above 50.0%\n",
+		},
+		{
+			list:      list[2:],
+			threshold: 0.5,
+			expect: "    N/A  qiniu.com/kodo/apiserver/server/empty.go  SKIP\n" +
+				"    N/A  Total                                     SKIP\n" +
+				"SKIP: no files with statements\n",
+		},
+	}
+	for _, tc := range items {
+		var buf bytes.Buffer
+		assert.NoError(t, tc.list.WriteTextWithOptions(&buf, TextOptions{Threshold: &tc.threshold}))
+		assert.Equal(t, tc.expect, buf.String())
+	}
+}
+
+func TestWriteVetStyle(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	list, err := CovList(strings.NewReader("mode: count\n" +
+		fileName + ":32.49,33.13 1 30\n" +
+		fileName + ":42.49,43.13 2 0\n" +
+		fileName + ":50.1,50.1 0 0\n" +
+		"qiniu.com/kodo/apiserver/server/svr.go:7.2,8.3 1 0\n"))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, list.WriteVetStyle(&buf))
+	assert.Equal(t, fileName+":42:49: not covered\n"+
+		"qiniu.com/kodo/apiserver/server/svr.go:7:2: not covered\n", buf.String())
+}
+
+func TestSplitByPackage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-split-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	outDir := filepath.Join(dir, "out", "pkgs")
+
+	profile := "mode: count\n" +
+		"qiniu.com/kodo/apiserver/main.go:1.1,2.1 1 3\n" +
+		"qiniu.com/kodo/apiserver/server/svr.go:1.1,2.1 1 0\n" +
+		"qiniu.com/kodo/apiserver/main.go:3.1,4.1 2 0\n"
+	assert.NoError(t, SplitByPackage(strings.NewReader(profile), outDir))
+
+	files, err := ioutil.ReadDir(outDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(files))
+	content, err := ioutil.ReadFile(filepath.Join(outDir, "qiniu.com%2Fkodo%2Fapiserver.cov"))
+	assert.NoError(t, err)
+	assert.Equal(t, "mode: count\n"+
+		"qiniu.com/kodo/apiserver/main.go:1.1,2.1 1 3\n"+
+		"qiniu.com/kodo/apiserver/main.go:3.1,4.1 2 0\n", string(content))
+	list, err := CovList(bytes.NewReader(content))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, list[0].NAllStmts)
+	_, err = os.Stat(filepath.Join(outDir, "qiniu.com%2Fkodo%2Fapiserver%2Fserver.cov"))
+	assert.NoError(t, err)
+
+	assert.Error(t, SplitByPackage(strings.NewReader("no mode\n"), outDir))
+}
+
+func TestPackageProfileName(t *testing.T) {
+	items := map[string]string{
+		"qiniu.com/kodo/apiserver": "qiniu.com%2Fkodo%2Fapiserver.cov",
+		"a_b/c-d":                  "a_b%2Fc-d.cov",
+		"_/home/x y:z":             "_%2Fhome%2Fx%20y%3Az.cov",
+		"a%2Fb":                    "a%252Fb.cov",
+	}
+	for pkg, expect := range items {
+		assert.Equal(t, expect, PackageProfileName(pkg))
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	items := []struct {
+		ratios []float32
+		expect string
+	}{
+		{ratios: nil, expect: ""},
+		{ratios: []float32{0.5}, expect: "▅"},
+		{ratios: []float32{0.8, 0.8, 0.8}, expect: "▅▅▅"},
+		{ratios: []float32{0.1, 0.2, 0.3, 0.4, 0.5, 0.6, 0.7, 0.8}, expect: "▁▂▃▄▅▆▇█"},
+		{ratios: []float32{0.80, 0.82, 0.81, 0.84}, expect: "▁▅▃█"},
+	}
+	for _, tc := range items {
+		assert.Equal(t, tc.expect, Sparkline(tc.ratios), tc.ratios)
+	}
+}
+
+func TestWriteProfileFiltered(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	fileName1 := "qiniu.com/kodo/apiserver/server/svr.go"
+	profile := "mode: atomic\n" +
+		fileName + ":32.49,33.13 1 30\n" +
+		fileName + ":42.49,43.13 1 0\n" +
+		fileName1 + ":10.1,12.2 2 0\n"
+	list, err := CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, list.WriteProfile(&buf))
+	assert.Equal(t, profile, buf.String())
+
+	buf.Reset()
+	assert.NoError(t, list.WriteProfileFiltered(&buf, func(b CoverBlock) bool { return b.Count == 0 }))
+	assert.Equal(t, "mode: atomic\n"+
+		fileName+":42.49,43.13 1 0\n"+
+		fileName1+":10.1,12.2 2 0\n", buf.String())
+
+	list[0].Mode = "set"
+	assert.Error(t, list.WriteProfile(&buf))
+}
+
+func TestWritePackageJSON(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "example.com/b/b.go", NCoveredStmts: 0, NAllStmts: 0},
+		Coverage{FileName: "example.com/a/a.go", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: "example.com/a/a2.go", NCoveredStmts: 5, NAllStmts: 20},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, list.WritePackageJSON(&buf))
+	assert.Equal(t, `[{"package":"example.com/a","covered":20,"total":40,"ratio":0.5},`+
+		`{"package":"example.com/b","covered":0,"total":0,"ratio":null}]`+"\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, CoverageList{}.WritePackageJSON(&buf))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "a.go", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: `b"\.go`, NCoveredStmts: 5, NAllStmts: 5},
+		Coverage{FileName: "c.go", NCoveredStmts: 0, NAllStmts: 0},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, list.WriteOpenMetrics(&buf, "goc"))
+	assert.Equal(t, "# TYPE goc_file_coverage_ratio gauge\n"+
+		"# UNIT goc_file_coverage_ratio ratio\n"+
+		"# HELP goc_file_coverage_ratio Statement coverage ratio of a file.\n"+
+		`goc_file_coverage_ratio{file="a.go"} 0.75`+"\n"+
+		`goc_file_coverage_ratio{file="b\"\\.go"} 1`+"\n"+
+		"# TYPE goc_coverage_ratio gauge\n"+
+		"# UNIT goc_coverage_ratio ratio\n"+
+		"# HELP goc_coverage_ratio Total statement coverage ratio.\n"+
+		"goc_coverage_ratio 0.8\n"+
+		"# EOF\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, CoverageList{}.WriteOpenMetrics(&buf, ""))
+	assert.Equal(t, "# TYPE file_coverage_ratio gauge\n"+
+		"# UNIT file_coverage_ratio ratio\n"+
+		"# HELP file_coverage_ratio Statement coverage ratio of a file.\n"+
+		"# TYPE coverage_ratio gauge\n"+
+		"# UNIT coverage_ratio ratio\n"+
+		"# HELP coverage_ratio Total statement coverage ratio.\n"+
+		"# EOF\n", buf.String())
+
+	assert.Error(t, list.WriteOpenMetrics(&buf, "goc-ci"))
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "a.go", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: "b.go", NCoveredStmts: 0, NAllStmts: 0},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, list.WriteNDJSON(&buf))
+	assert.Equal(t, `{"file":"a.go","covered":15,"total":20,"ratio":0.75,"percentage":"75.0%"}`+"\n"+
+		`{"file":"b.go","covered":0,"total":0,"ratio":null,"percentage":"N/A"}`+"\n", buf.String())
+}
@@ -0,0 +1,84 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import "fmt"
+
+// GateResult is the outcome of a coverage gate check
+type GateResult struct {
+	Pass       bool
+	Threshold  float32  // required total ratio, between 0 and 1
+	TotalRatio float32  // total ratio of the new profile
+	TotalDelta float32  // total ratio delta against the base profile, 0 if no base
+	FilesBelow []string // files of the new profile whose ratio is below the threshold
+	Dropped    []string // files alerted by AlertDrops, which do not fail the gate
+	Details    []string // human readable reasons of the result
+}
+
+// CheckGate checks whether newList meets the threshold without any side effect,
+// it never logs or exits so the caller can decide what to do with the result.
+// baseList can be nil, in which case no delta is reported.
+func CheckGate(newList CoverageList, baseList CoverageList, threshold float32) GateResult {
+	res := GateResult{Threshold: threshold}
+
+	ratio, err := newList.TotalRatio()
+	if err != nil {
+		res.Pass = true
+		res.Details = append(res.Details, "new profile has no statement, skip gating")
+		return res
+	}
+	res.TotalRatio = ratio
+	if baseList != nil {
+		res.TotalDelta = TotalDelta(newList, baseList)
+	}
+
+	for _, c := range newList {
+		r, err := c.Ratio()
+		if err != nil {
+			continue
+		}
+		if r < threshold {
+			res.FilesBelow = append(res.FilesBelow, c.Name())
+		}
+	}
+
+	res.Pass = ratio >= threshold
+	if res.Pass {
+		res.Details = append(res.Details, fmt.Sprintf("total coverage %s meets threshold %s", PercentStr(ratio), PercentStr(threshold)))
+	} else {
+		res.Details = append(res.Details, fmt.Sprintf("total coverage %s is below threshold %s", PercentStr(ratio), PercentStr(threshold)))
+	}
+	return res
+}
+
+// DropAlerts returns the files whose ratio dropped by more than alertDrop against baseList,
+// sorted by file name, whether or not they meet the threshold of the gate: a well covered
+// file losing 10 points is a local regression the total ratio hides. The files not in
+// baseList or without statements are never alerted.
+func DropAlerts(newList CoverageList, baseList CoverageList, alertDrop float32) []Regression {
+	return newList.Regressions(baseList, alertDrop, false)
+}
+
+// AlertDrops adds the DropAlerts of newList to the result with their reasons, next to the
+// files below the threshold, without changing whether the gate passes.
+func (res *GateResult) AlertDrops(newList CoverageList, baseList CoverageList, alertDrop float32) {
+	for _, r := range DropAlerts(newList, baseList, alertDrop) {
+		res.Dropped = append(res.Dropped, r.File)
+		res.Details = append(res.Details, fmt.Sprintf("coverage of %s dropped from %s to %s",
+			r.File, PercentStr(*r.BaseRatio), PercentStr(r.NewRatio)))
+	}
+}
@@ -0,0 +1,96 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckGate(t *testing.T) {
+	items := []struct {
+		newList     CoverageList
+		baseList    CoverageList
+		threshold   float32
+		expectPass  bool
+		expectBelow []string
+	}{
+		{
+			newList:    CoverageList{Coverage{FileName: "a", NCoveredStmts: 15, NAllStmts: 20}},
+			threshold:  0.7,
+			expectPass: true,
+		},
+		{
+			newList: CoverageList{Coverage{FileName: "a", NCoveredStmts: 15, NAllStmts: 20},
+				Coverage{FileName: "b", NCoveredStmts: 0, NAllStmts: 20}},
+			baseList:    CoverageList{Coverage{FileName: "a", NCoveredStmts: 10, NAllStmts: 20}},
+			threshold:   0.5,
+			expectPass:  false,
+			expectBelow: []string{"b"},
+		},
+		// no statement at all
+		{
+			newList:    CoverageList{Coverage{FileName: "a", NCoveredStmts: 0, NAllStmts: 0}},
+			threshold:  0.9,
+			expectPass: true,
+		},
+	}
+
+	for _, tc := range items {
+		res := CheckGate(tc.newList, tc.baseList, tc.threshold)
+		assert.Equal(t, tc.expectPass, res.Pass)
+		assert.Equal(t, tc.expectBelow, res.FilesBelow)
+		assert.NotEmpty(t, res.Details)
+	}
+}
+
+func TestDropAlerts(t *testing.T) {
+	base := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 19, NAllStmts: 20},
+		Coverage{FileName: "b", NCoveredStmts: 10, NAllStmts: 20},
+		Coverage{FileName: "c", NCoveredStmts: 10, NAllStmts: 20},
+	}
+	newList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 16, NAllStmts: 20},
+		Coverage{FileName: "b", NCoveredStmts: 9, NAllStmts: 20},
+		Coverage{FileName: "c", NCoveredStmts: 12, NAllStmts: 20},
+		Coverage{FileName: "d", NCoveredStmts: 0, NAllStmts: 20},
+	}
+	items := []struct {
+		alertDrop float32
+		expect    []string
+	}{
+		{alertDrop: 0.1, expect: []string{"a"}},
+		{alertDrop: 0.01, expect: []string{"a", "b"}},
+		{alertDrop: 0.2, expect: nil},
+	}
+	for _, tc := range items {
+		var files []string
+		for _, r := range DropAlerts(newList, base, tc.alertDrop) {
+			files = append(files, r.File)
+		}
+		assert.Equal(t, tc.expect, files)
+	}
+
+	res := CheckGate(newList, base, 0.4)
+	pass := res.Pass
+	res.AlertDrops(newList, base, 0.1)
+	assert.Equal(t, pass, res.Pass)
+	assert.Equal(t, []string{"a"}, res.Dropped)
+	assert.Contains(t, res.Details, "coverage of a dropped from 95.0% to 80.0%")
+}
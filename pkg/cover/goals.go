@@ -0,0 +1,161 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DefaultGoalRule is the rule of a GoalViolation against the default goal
+const DefaultGoalRule = "default"
+
+// GoalSet is a manifest of the minimum ratios of the files, like
+//
+//	default: 0.6
+//	goals:
+//	  example.com/foo/...: 0.8
+//	  example.com/foo/bar/*.go: 0.9
+//
+// A glob is matched against the file name by path.Match, or, if it contains the "..."
+// wildcard, against the package of the file like CoverageOfPackages. The most specific
+// glob, i.e. with the most characters besides the wildcards, wins.
+type GoalSet struct {
+	Default float32            `json:"default" yaml:"default"`
+	Goals   map[string]float32 `json:"goals" yaml:"goals"`
+}
+
+// GoalViolation is a file below the goal of its rule
+type GoalViolation struct {
+	File      string  `json:"file"`
+	Rule      string  `json:"rule"` // the glob of the goal, DefaultGoalRule for the default
+	Goal      float32 `json:"goal"`
+	Ratio     float32 `json:"ratio"`
+	Shortfall float32 `json:"shortfall"` // Goal - Ratio
+}
+
+// LoadGoals reads a GoalSet from a YAML or JSON file, unknown fields are rejected so
+// that a misspelled key does not silently disable a goal
+func LoadGoals(path string) (*GoalSet, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	goals := &GoalSet{}
+	if err := yaml.UnmarshalStrict(content, goals); err != nil {
+		return nil, fmt.Errorf("parse goals %s failed: %v", path, err)
+	}
+	if err := goals.validate(); err != nil {
+		return nil, fmt.Errorf("bad goals %s: %v", path, err)
+	}
+	return goals, nil
+}
+
+func (s *GoalSet) validate() error {
+	if s.Default < 0 || s.Default > 1 {
+		return fmt.Errorf("default goal %v is not between 0 and 1", s.Default)
+	}
+	for glob, goal := range s.Goals {
+		if goal < 0 || goal > 1 {
+			return fmt.Errorf("goal %v of %s is not between 0 and 1", goal, glob)
+		}
+		if _, err := path.Match(glob, ""); err != nil {
+			return fmt.Errorf("bad glob %s: %v", glob, err)
+		}
+	}
+	return nil
+}
+
+// CheckGoals returns the files whose ratio is below the goal of their most specific rule,
+// or the default goal if none matches, sorted by file name. Files without any statement
+// are skipped.
+func (g CoverageList) CheckGoals(goals *GoalSet) []GoalViolation {
+	rules := goals.rules()
+	var violations []GoalViolation
+	for i := range g {
+		ratio, err := g[i].Ratio()
+		if err != nil {
+			continue
+		}
+		rule, goal := DefaultGoalRule, goals.Default
+		file := filepath.ToSlash(g[i].Name())
+		for _, r := range rules {
+			if r.match(file) {
+				rule, goal = r.glob, goals.Goals[r.glob]
+				break
+			}
+		}
+		if ratio < goal {
+			violations = append(violations, GoalViolation{
+				File:      g[i].Name(),
+				Rule:      rule,
+				Goal:      goal,
+				Ratio:     ratio,
+				Shortfall: goal - ratio,
+			})
+		}
+	}
+	sort.SliceStable(violations, func(i, j int) bool { return violations[i].File < violations[j].File })
+	return violations
+}
+
+// goalRule is a glob of a GoalSet
+type goalRule struct {
+	glob       string
+	pkgPattern *regexp.Regexp // set for the globs with "..."
+}
+
+func (r *goalRule) match(file string) bool {
+	if r.pkgPattern != nil {
+		return r.pkgPattern.MatchString(path.Dir(file))
+	}
+	ok, _ := path.Match(r.glob, file)
+	return ok
+}
+
+// rules returns the rules of the goals, the most specific first
+func (s *GoalSet) rules() []goalRule {
+	rules := make([]goalRule, 0, len(s.Goals))
+	for glob := range s.Goals {
+		r := goalRule{glob: glob}
+		if strings.Contains(glob, "...") {
+			r.pkgPattern = packagePatternRegexp(glob)
+		}
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		si, sj := globSpecificity(rules[i].glob), globSpecificity(rules[j].glob)
+		if si != sj {
+			return si > sj
+		}
+		return rules[i].glob < rules[j].glob
+	})
+	return rules
+}
+
+// globSpecificity returns the number of characters of the glob besides the wildcards
+func globSpecificity(glob string) int {
+	glob = strings.ReplaceAll(glob, "...", "")
+	return len(glob) - strings.Count(glob, "*") - strings.Count(glob, "?")
+}
@@ -0,0 +1,105 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadGoals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-goals-test")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer os.RemoveAll(dir)
+
+	items := []struct {
+		name      string
+		content   string
+		expect    *GoalSet
+		expectErr bool
+	}{
+		{
+			name:    "goals.yaml",
+			content: "default: 0.6\ngoals:\n  example.com/foo/...: 0.8\n  \"example.com/foo/*.go\": 0.9\n",
+			expect:  &GoalSet{Default: 0.6, Goals: map[string]float32{"example.com/foo/...": 0.8, "example.com/foo/*.go": 0.9}},
+		},
+		{
+			name:    "goals.json",
+			content: `{"default": 0.5, "goals": {"a.go": 1}}`,
+			expect:  &GoalSet{Default: 0.5, Goals: map[string]float32{"a.go": 1}},
+		},
+		{name: "unknown.yaml", content: "default: 0.6\ngoal:\n  a.go: 0.8\n", expectErr: true},
+		{name: "ratio.yaml", content: "goals:\n  a.go: 80\n", expectErr: true},
+		{name: "glob.yaml", content: "goals:\n  \"[a.go\": 0.8\n", expectErr: true},
+	}
+	for _, tc := range items {
+		p := filepath.Join(dir, tc.name)
+		assert.NoError(t, ioutil.WriteFile(p, []byte(tc.content), 0644))
+		goals, err := LoadGoals(p)
+		if tc.expectErr {
+			assert.Error(t, err, tc.name)
+			continue
+		}
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.expect, goals, tc.name)
+	}
+
+	_, err = LoadGoals(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestCheckGoals(t *testing.T) {
+	goals := &GoalSet{
+		Default: 0.5,
+		Goals: map[string]float32{
+			"example.com/foo/...":      0.7,
+			"example.com/foo/bar/*.go": 0.9,
+			"example.com/foo/bar/x.go": 0.2,
+		},
+	}
+	list := CoverageList{
+		{FileName: "example.com/foo/bar/b.go", NCoveredStmts: 8, NAllStmts: 10},
+		{FileName: "example.com/foo/bar/x.go", NCoveredStmts: 3, NAllStmts: 10},
+		{FileName: "example.com/foo/a.go", NCoveredStmts: 6, NAllStmts: 10},
+		{FileName: "example.com/foo/baz/c.go", NCoveredStmts: 7, NAllStmts: 10},
+		{FileName: "example.com/other/d.go", NCoveredStmts: 4, NAllStmts: 10},
+		{FileName: "example.com/other/e.go", NCoveredStmts: 0, NAllStmts: 0},
+	}
+	violations := list.CheckGoals(goals)
+	if assert.Equal(t, 3, len(violations)) {
+		assert.Equal(t, "example.com/foo/a.go", violations[0].File)
+		assert.Equal(t, "example.com/foo/...", violations[0].Rule)
+		assert.InDelta(t, 0.1, violations[0].Shortfall, 1e-6)
+
+		assert.Equal(t, "example.com/foo/bar/b.go", violations[1].File)
+		assert.Equal(t, "example.com/foo/bar/*.go", violations[1].Rule)
+		assert.Equal(t, float32(0.9), violations[1].Goal)
+		assert.Equal(t, float32(0.8), violations[1].Ratio)
+
+		assert.Equal(t, "example.com/other/d.go", violations[2].File)
+		assert.Equal(t, DefaultGoalRule, violations[2].Rule)
+		assert.InDelta(t, 0.1, violations[2].Shortfall, 1e-6)
+	}
+
+	assert.Empty(t, list.CheckGoals(&GoalSet{}))
+}
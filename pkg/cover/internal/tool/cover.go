@@ -306,7 +306,7 @@ func (f *File) Visit(node ast.Node) ast.Visitor {
 // 1. add cover variables into the original file
 // 2. return the cover variables declarations as plain string
 // original dec: func annotate(name string) {
-func Annotate(name string, mode string, varVar string, globalCoverVarImportPath string) string {
+func Annotate(name string, mode string, varVar string, globalCoverVarImportPath string) (string, error) {
 	// QINIU
 	switch mode {
 	case "set":
@@ -322,11 +322,11 @@ func Annotate(name string, mode string, varVar string, globalCoverVarImportPath
 	fset := token.NewFileSet()
 	content, err := ioutil.ReadFile(name)
 	if err != nil {
-		log.Fatalf("cover: %s: %s", name, err)
+		return "", fmt.Errorf("cover: %s: %s", name, err)
 	}
 	parsedFile, err := parser.ParseFile(fset, name, content, parser.ParseComments)
 	if err != nil {
-		log.Fatalf("cover: %s: %s", name, err)
+		return "", fmt.Errorf("cover: %s: %s", name, err)
 	}
 
 	file := &File{
@@ -377,14 +377,14 @@ func Annotate(name string, mode string, varVar string, globalCoverVarImportPath
 	// }
 	fd, err := os.Create(name)
 	if err != nil {
-		log.Fatalf("cover: %s", err)
+		return "", fmt.Errorf("cover: %s", err)
 	}
 	defer fd.Close()
 
 	fmt.Fprintf(fd, "//line %s:1\n", name)
 	_, err = fd.Write(newContent)
 	if err != nil {
-		log.Fatalf("cover: %s", err)
+		return "", fmt.Errorf("cover: %s", err)
 	}
 
 	// After printing the source tree, add some declarations for the counters etc.
@@ -395,7 +395,7 @@ func Annotate(name string, mode string, varVar string, globalCoverVarImportPath
 	// we will write all declarations into a single file
 	declBuf := bytes.NewBufferString("")
 	file.addVariables(declBuf)
-	return declBuf.String()
+	return declBuf.String(), nil
 }
 
 // setCounterStmt returns the expression: __count[23] = 1.
@@ -0,0 +1,38 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import "github.com/sirupsen/logrus"
+
+// Logger receives the diagnostics of the package, the default is the logrus standard
+// logger. The package never exits the process itself, failures are returned as errors.
+type Logger interface {
+	Printf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+var logger Logger = logrus.StandardLogger()
+
+// SetLogger routes the diagnostics of the package to l, nil restores the default
+func SetLogger(l Logger) {
+	if l == nil {
+		l = logrus.StandardLogger()
+	}
+	logger = l
+}
@@ -0,0 +1,67 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordLogger records the diagnostics instead of printing them
+type recordLogger struct {
+	lines []string
+}
+
+func (l *recordLogger) Printf(format string, args ...interface{}) {
+	l.lines = append(l.lines, "print "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Infof(format string, args ...interface{}) {
+	l.lines = append(l.lines, "info "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Warnf(format string, args ...interface{}) {
+	l.lines = append(l.lines, "warn "+fmt.Sprintf(format, args...))
+}
+
+func (l *recordLogger) Errorf(format string, args ...interface{}) {
+	l.lines = append(l.lines, "error "+fmt.Sprintf(format, args...))
+}
+
+func TestSetLogger(t *testing.T) {
+	l := &recordLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	_, err := ReadFileToCoverList("nonexist.cov")
+	assert.Error(t, err)
+	assert.Equal(t, []string{"error Open file nonexist.cov failed!"}, l.lines)
+}
+
+func TestListPackagesWithoutGo(t *testing.T) {
+	SetLogger(&recordLogger{})
+	defer SetLogger(nil)
+	path := os.Getenv("PATH")
+	os.Setenv("PATH", "")
+	defer os.Setenv("PATH", path)
+
+	_, err := ListPackages(".", "-json ./...", "")
+	assert.Equal(t, ErrGoNotFound, err)
+}
@@ -0,0 +1,508 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MergePolicy decides how the hit counts of the same block are merged
+type MergePolicy int
+
+const (
+	// MergeSum sums the hit counts of the same block, which is the default
+	MergeSum MergePolicy = iota
+	// MergeMax keeps the highest hit count of the same block, useful when the
+	// same path is exercised by multiple instances and summing overstates it
+	MergeMax
+	// MergeUnion sums the hit counts like MergeSum. When merging file level coverage
+	// by MergeLists it takes the max statement count seen per file as the denominator
+	// and sums the covered statements bounded by it: the instances should agree on the
+	// statements of a file, but an instance not compiling the file due to build tags
+	// would otherwise shrink or inflate its total.
+	MergeUnion
+)
+
+// blockKey identifies a block in a file
+type blockKey struct {
+	startLine, startCol, endLine, endCol int
+}
+
+func keyOf(b *CoverBlock) blockKey {
+	return blockKey{b.StartLine, b.StartCol, b.EndLine, b.EndCol}
+}
+
+// fileBlocks holds the merged blocks of one file in first seen order
+type fileBlocks struct {
+	index  map[blockKey]int
+	blocks []CoverBlock
+}
+
+// ConflictResolver resolves a file whose blocks in an added profile, b, differ from the
+// ones merged so far, a, e.g. after the source drifted between the profiles. Both carry
+// their blocks, the ones of the returned coverage replace the merged ones of the file.
+// Returning an error aborts the merge.
+type ConflictResolver func(a, b Coverage) (Coverage, error)
+
+// KeepLatest is a ConflictResolver taking the coverage of the latest added profile
+func KeepLatest(a, b Coverage) (Coverage, error) {
+	return b, nil
+}
+
+// Accumulator merges multiple profiles block by block
+type Accumulator struct {
+	policy   MergePolicy
+	mode     string
+	files    map[string]*fileBlocks
+	order    []string
+	resolver ConflictResolver
+}
+
+// NewAccumulator creates an Accumulator merging with the given policy
+func NewAccumulator(policy MergePolicy) *Accumulator {
+	return &Accumulator{
+		policy: policy,
+		files:  make(map[string]*fileBlocks),
+	}
+}
+
+// SetConflictResolver makes the accumulator call resolver on the files whose blocks differ
+// between the profiles, instead of failing on mismatched statement counts and merging the
+// differing blocks. A nil resolver restores the default.
+func (a *Accumulator) SetConflictResolver(resolver ConflictResolver) {
+	a.resolver = resolver
+}
+
+// Mode returns the mode of the merged profiles
+func (a *Accumulator) Mode() string {
+	return a.mode
+}
+
+// Add merges the profile into the accumulator, all the profiles must share the same mode
+func (a *Accumulator) Add(r io.Reader) error {
+	mode, blocks, err := ParseBlocks(r)
+	if err != nil {
+		return err
+	}
+	return a.addBlocks(mode, blocks)
+}
+
+func (a *Accumulator) addBlocks(mode string, blocks []CoverBlock) error {
+	if a.mode != "" && a.mode != mode {
+		return fmt.Errorf("mode mismatch: %s vs %s", a.mode, mode)
+	}
+	a.mode = mode
+	if a.resolver != nil {
+		return a.resolveBlocks(blocks)
+	}
+	for i := range blocks {
+		if err := a.addBlock(&blocks[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveBlocks merges the blocks file by file, calling the resolver on the conflicting ones
+func (a *Accumulator) resolveBlocks(blocks []CoverBlock) error {
+	var order []string
+	byFile := make(map[string][]CoverBlock)
+	for _, b := range blocks {
+		if _, ok := byFile[b.FileName]; !ok {
+			order = append(order, b.FileName)
+		}
+		byFile[b.FileName] = append(byFile[b.FileName], b)
+	}
+	for _, file := range order {
+		fb, ok := a.files[file]
+		if !ok || !fb.conflicts(byFile[file]) {
+			for i := range byFile[file] {
+				if err := a.addBlock(&byFile[file][i]); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		resolved, err := a.resolver(a.coverageOf(file, fb.blocks), a.coverageOf(file, byFile[file]))
+		if err != nil {
+			return fmt.Errorf("resolve conflict of %s: %v", file, err)
+		}
+		fb = &fileBlocks{index: make(map[blockKey]int)}
+		for _, b := range resolved.Blocks {
+			b.FileName = file
+			fb.index[keyOf(&b)] = len(fb.blocks)
+			fb.blocks = append(fb.blocks, b)
+		}
+		a.files[file] = fb
+	}
+	return nil
+}
+
+// conflicts reports whether the blocks of a profile differ from the merged ones in their
+// positions or statement counts
+func (fb *fileBlocks) conflicts(blocks []CoverBlock) bool {
+	if len(blocks) != len(fb.blocks) {
+		return true
+	}
+	for i := range blocks {
+		j, ok := fb.index[keyOf(&blocks[i])]
+		if !ok || fb.blocks[j].NumStmt != blocks[i].NumStmt {
+			return true
+		}
+	}
+	return false
+}
+
+// coverageOf returns the coverage of a file with a copy of its blocks
+func (a *Accumulator) coverageOf(file string, blocks []CoverBlock) Coverage {
+	c := Coverage{FileName: file, Mode: a.mode, Blocks: append([]CoverBlock(nil), blocks...)}
+	for _, b := range blocks {
+		c.NAllStmts += b.NumStmt
+		if b.Count > 0 {
+			c.NCoveredStmts += b.NumStmt
+		}
+	}
+	return c
+}
+
+func (a *Accumulator) addBlock(b *CoverBlock) error {
+	fb, ok := a.files[b.FileName]
+	if !ok {
+		fb = &fileBlocks{index: make(map[blockKey]int)}
+		a.files[b.FileName] = fb
+		a.order = append(a.order, b.FileName)
+	}
+	i, ok := fb.index[keyOf(b)]
+	if !ok {
+		fb.index[keyOf(b)] = len(fb.blocks)
+		fb.blocks = append(fb.blocks, *b)
+		return nil
+	}
+	merged := &fb.blocks[i]
+	if merged.NumStmt != b.NumStmt {
+		return fmt.Errorf("statement count mismatch for %s:%d.%d,%d.%d: %d vs %d", b.FileName,
+			b.StartLine, b.StartCol, b.EndLine, b.EndCol, merged.NumStmt, b.NumStmt)
+	}
+	merged.Count = a.mergeCount(merged.Count, b.Count)
+	return nil
+}
+
+func (a *Accumulator) mergeCount(x, y int64) int64 {
+	// set mode only records whether the block is covered
+	if a.policy == MergeMax || a.mode == "set" {
+		if x > y {
+			return x
+		}
+		return y
+	}
+	return x + y
+}
+
+// List returns the merged coverage of all the added profiles
+func (a *Accumulator) List() CoverageList {
+	g := NewCoverageList()
+	for _, file := range a.order {
+		for i := range a.files[file].blocks {
+			blk := a.files[file].blocks[i]
+			blk.addToGroupCov(&g)
+		}
+	}
+	g.setMode(a.mode)
+	return g
+}
+
+// ConcurrentAccumulator is an Accumulator safe for concurrent use, e.g. by a service
+// collecting the profiles of many clients
+type ConcurrentAccumulator struct {
+	mu  sync.Mutex
+	acc *Accumulator
+}
+
+// NewConcurrentAccumulator creates a ConcurrentAccumulator merging with the given policy
+func NewConcurrentAccumulator(policy MergePolicy) *ConcurrentAccumulator {
+	return &ConcurrentAccumulator{acc: NewAccumulator(policy)}
+}
+
+// Add merges the profile into the accumulator like Accumulator.Add, the profile is
+// parsed before taking the lock
+func (a *ConcurrentAccumulator) Add(r io.Reader) error {
+	mode, blocks, err := ParseBlocks(r)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.acc.addBlocks(mode, blocks)
+}
+
+// Mode returns the mode of the merged profiles
+func (a *ConcurrentAccumulator) Mode() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.acc.Mode()
+}
+
+// Snapshot returns a copy of the merged coverage of the profiles added so far, later
+// additions do not change it
+func (a *ConcurrentAccumulator) Snapshot() CoverageList {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.acc.List()
+}
+
+// MergeStream merges the profiles received from in like an Accumulator with MergeSum until
+// in is closed, e.g. by a collector receiving profiles over time. If ctx is done first, or
+// a profile is malformed, the coverage merged so far is returned along with the error.
+func MergeStream(ctx context.Context, in <-chan io.Reader) (*CoverageList, error) {
+	acc := NewAccumulator(MergeSum)
+	for {
+		select {
+		case <-ctx.Done():
+			list := acc.List()
+			return &list, ctx.Err()
+		case r, ok := <-in:
+			if !ok {
+				list := acc.List()
+				return &list, nil
+			}
+			if err := acc.Add(r); err != nil {
+				list := acc.List()
+				return &list, err
+			}
+		}
+	}
+}
+
+// MergeLists merges the file level coverage of the lists by the statement counts only:
+// MergeSum sums the counts like Coalesce, MergeMax keeps the max of each and MergeUnion
+// is described along with it. The retained blocks are dropped, Accumulator merges
+// profiles block by block instead. The order of the first occurrences is kept.
+func MergeLists(policy MergePolicy, lists ...CoverageList) CoverageList {
+	res := NewCoverageList()
+	index := make(map[string]int)
+	for _, list := range lists {
+		for _, c := range list {
+			c.Blocks = nil
+			i, ok := index[c.Name()]
+			if !ok {
+				index[c.Name()] = len(res)
+				res = append(res, c)
+				continue
+			}
+			m := &res[i]
+			switch policy {
+			case MergeMax:
+				m.NAllStmts = maxInt(m.NAllStmts, c.NAllStmts)
+				m.NCoveredStmts = maxInt(m.NCoveredStmts, c.NCoveredStmts)
+			case MergeUnion:
+				m.NAllStmts = maxInt(m.NAllStmts, c.NAllStmts)
+				m.NCoveredStmts += c.NCoveredStmts
+			default:
+				m.NAllStmts += c.NAllStmts
+				m.NCoveredStmts += c.NCoveredStmts
+			}
+		}
+	}
+	if policy == MergeUnion {
+		for i := range res {
+			if res[i].NCoveredStmts > res[i].NAllStmts {
+				res[i].NCoveredStmts = res[i].NAllStmts
+			}
+		}
+	}
+	return res
+}
+
+// VerifyMerge checks that every file of merged has as many statements as the largest of
+// it in the parts and the union of their covered statements covered, and that merged has
+// exactly the files of the parts, as a sanity check of a merge pipeline. The union is
+// computed from the retained blocks, a file without them in some part is only checked to
+// cover between the most covered of the parts and its statements. The discrepancies are
+// reported per file in the returned error.
+func VerifyMerge(merged *CoverageList, parts []*CoverageList) error {
+	type expectation struct {
+		all, maxCovered int
+		blocksOK        bool
+		covered         map[blockKey]int // NumStmt of the covered blocks
+	}
+	expect := make(map[string]*expectation)
+	var files []string
+	for _, part := range parts {
+		for _, c := range *part {
+			e, ok := expect[c.Name()]
+			if !ok {
+				e = &expectation{blocksOK: true, covered: make(map[blockKey]int)}
+				expect[c.Name()] = e
+				files = append(files, c.Name())
+			}
+			e.all = maxInt(e.all, c.NAllStmts)
+			e.maxCovered = maxInt(e.maxCovered, c.NCoveredStmts)
+			if len(c.Blocks) == 0 && c.NAllStmts > 0 {
+				e.blocksOK = false
+			}
+			for i := range c.Blocks {
+				if b := &c.Blocks[i]; b.Count > 0 {
+					e.covered[keyOf(b)] = b.NumStmt
+				}
+			}
+		}
+	}
+
+	var problems []string
+	seen := make(map[string]bool)
+	for _, c := range *merged {
+		e, ok := expect[c.Name()]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: not in any part", c.Name()))
+			continue
+		}
+		seen[c.Name()] = true
+		if c.NAllStmts != e.all {
+			problems = append(problems, fmt.Sprintf("%s: %d statements, expect %d", c.Name(), c.NAllStmts, e.all))
+		}
+		if e.blocksOK {
+			covered := 0
+			for _, n := range e.covered {
+				covered += n
+			}
+			if c.NCoveredStmts != covered {
+				problems = append(problems, fmt.Sprintf("%s: %d covered, expect %d", c.Name(), c.NCoveredStmts, covered))
+			}
+		} else if c.NCoveredStmts < e.maxCovered || c.NCoveredStmts > e.all {
+			problems = append(problems, fmt.Sprintf("%s: %d covered, expect %d to %d", c.Name(), c.NCoveredStmts, e.maxCovered, e.all))
+		}
+	}
+	for _, name := range files {
+		if !seen[name] {
+			problems = append(problems, fmt.Sprintf("%s: missing in the merged profile", name))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("merged profile mismatches its parts: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func maxInt(x, y int) int {
+	if x > y {
+		return x
+	}
+	return y
+}
+
+// LabeledAccumulator merges profiles like Accumulator and records which labels,
+// e.g. the services or test suites the profiles come from, covered each file
+type LabeledAccumulator struct {
+	acc    *Accumulator
+	labels map[string]map[string]bool
+}
+
+// NewLabeledAccumulator creates a LabeledAccumulator merging with the given policy
+func NewLabeledAccumulator(policy MergePolicy) *LabeledAccumulator {
+	return &LabeledAccumulator{
+		acc:    NewAccumulator(policy),
+		labels: make(map[string]map[string]bool),
+	}
+}
+
+// Add merges the profile with the label, adding the same label multiple times is allowed
+func (a *LabeledAccumulator) Add(label string, r io.Reader) error {
+	mode, blocks, err := ParseBlocks(r)
+	if err != nil {
+		return err
+	}
+	if err := a.acc.addBlocks(mode, blocks); err != nil {
+		return err
+	}
+	for _, b := range blocks {
+		if b.Count == 0 {
+			continue
+		}
+		if a.labels[b.FileName] == nil {
+			a.labels[b.FileName] = make(map[string]bool)
+		}
+		a.labels[b.FileName][label] = true
+	}
+	return nil
+}
+
+// Mode returns the mode of the merged profiles
+func (a *LabeledAccumulator) Mode() string {
+	return a.acc.Mode()
+}
+
+// List returns the merged coverage of all the added profiles, the labels do not affect the counts
+func (a *LabeledAccumulator) List() CoverageList {
+	return a.acc.List()
+}
+
+// Labels returns the sorted labels of the profiles covering at least one block of each file,
+// the files covered by no profile are left out
+func (a *LabeledAccumulator) Labels() map[string][]string {
+	res := make(map[string][]string, len(a.labels))
+	for file, set := range a.labels {
+		for label := range set {
+			res[file] = append(res[file], label)
+		}
+		sort.Strings(res[file])
+	}
+	return res
+}
+
+// NormalizeProfile writes the canonical form of the profile: a single mode header,
+// forward-slash file names, duplicated blocks merged, and the blocks sorted by file
+// then by position, so that profile artifacts are reproducible and diff cleanly
+func NormalizeProfile(r io.Reader, w io.Writer) error {
+	mode, blocks, err := ParseBlocks(r)
+	if err != nil {
+		return err
+	}
+	a := NewAccumulator(MergeSum)
+	a.mode = mode
+	for i := range blocks {
+		blocks[i].FileName = strings.ReplaceAll(blocks[i].FileName, "\\", "/")
+		if err := a.addBlock(&blocks[i]); err != nil {
+			return err
+		}
+	}
+
+	sort.Strings(a.order)
+	for _, fb := range a.files {
+		sort.SliceStable(fb.blocks, func(i, j int) bool {
+			return keyLess(keyOf(&fb.blocks[i]), keyOf(&fb.blocks[j]))
+		})
+	}
+	return a.List().WriteProfile(w)
+}
+
+func keyLess(a, b blockKey) bool {
+	if a.startLine != b.startLine {
+		return a.startLine < b.startLine
+	}
+	if a.startCol != b.startCol {
+		return a.startCol < b.startCol
+	}
+	if a.endLine != b.endLine {
+		return a.endLine < b.endLine
+	}
+	return a.endCol < b.endCol
+}
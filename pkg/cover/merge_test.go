@@ -0,0 +1,333 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccumulator(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	profiles := []string{
+		"mode: count\n" +
+			fileName + ":32.49,33.13 1 30\n" +
+			fileName + ":42.49,43.13 1 0\n",
+		"mode: count\n" +
+			fileName + ":32.49,33.13 1 10\n" +
+			fileName + ":42.49,43.13 1 0\n" +
+			fileName + ":52.49,53.13 2 4\n",
+	}
+
+	items := []struct {
+		policy       MergePolicy
+		expectCounts []int64
+	}{
+		{policy: MergeSum, expectCounts: []int64{40, 0, 4}},
+		{policy: MergeMax, expectCounts: []int64{30, 0, 4}},
+	}
+
+	for _, tc := range items {
+		a := NewAccumulator(tc.policy)
+		for _, p := range profiles {
+			assert.NoError(t, a.Add(strings.NewReader(p)))
+		}
+		assert.Equal(t, "count", a.Mode())
+		list := a.List()
+		assert.Equal(t, 1, len(list))
+		assert.Equal(t, 3, list[0].NCoveredStmts)
+		assert.Equal(t, 4, list[0].NAllStmts)
+		var counts []int64
+		for _, b := range list[0].Blocks {
+			counts = append(counts, b.Count)
+		}
+		assert.Equal(t, tc.expectCounts, counts)
+	}
+}
+
+func TestAccumulatorErr(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	a := NewAccumulator(MergeSum)
+	assert.NoError(t, a.Add(strings.NewReader("mode: count\n"+fileName+":32.49,33.13 1 30\n")))
+	// mode mismatch
+	assert.Error(t, a.Add(strings.NewReader("mode: set\n"+fileName+":32.49,33.13 1 1\n")))
+	// statement count mismatch
+	assert.Error(t, a.Add(strings.NewReader("mode: count\n"+fileName+":32.49,33.13 2 1\n")))
+	// no mode line
+	assert.Error(t, a.Add(strings.NewReader(fileName+":32.49,33.13 1 1\n")))
+}
+
+func TestAccumulatorConflictResolver(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	other := "qiniu.com/kodo/apiserver/server/svr.go"
+	older := "mode: count\n" +
+		fileName + ":32.49,33.13 1 30\n" +
+		fileName + ":42.49,43.13 1 0\n" +
+		other + ":10.1,11.2 1 1\n"
+	// main.go drifted, svr.go did not
+	newer := "mode: count\n" +
+		fileName + ":32.49,33.13 2 0\n" +
+		fileName + ":45.49,46.13 1 5\n" +
+		other + ":10.1,11.2 1 2\n"
+
+	a := NewAccumulator(MergeSum)
+	a.SetConflictResolver(KeepLatest)
+	assert.NoError(t, a.Add(strings.NewReader(older)))
+	assert.NoError(t, a.Add(strings.NewReader(newer)))
+	list := a.List()
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, fileName, list[0].FileName)
+	assert.Equal(t, 1, list[0].NCoveredStmts)
+	assert.Equal(t, 3, list[0].NAllStmts)
+	assert.Equal(t, 45, list[0].Blocks[1].StartLine)
+	assert.Equal(t, int64(3), list[1].Blocks[0].Count)
+
+	var conflicts []string
+	a = NewAccumulator(MergeSum)
+	a.SetConflictResolver(func(x, y Coverage) (Coverage, error) {
+		conflicts = append(conflicts, x.FileName)
+		assert.Equal(t, 2, x.NAllStmts)
+		assert.Equal(t, 3, y.NAllStmts)
+		return Coverage{}, fmt.Errorf("source drift")
+	})
+	assert.NoError(t, a.Add(strings.NewReader(older)))
+	assert.Error(t, a.Add(strings.NewReader(newer)))
+	assert.Equal(t, []string{fileName}, conflicts)
+
+	// without a resolver it fails on the mismatched statement count
+	a = NewAccumulator(MergeSum)
+	assert.NoError(t, a.Add(strings.NewReader(older)))
+	assert.Error(t, a.Add(strings.NewReader(newer)))
+}
+
+func TestConcurrentAccumulator(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	profile := "mode: count\n" +
+		fileName + ":32.49,33.13 1 1\n" +
+		fileName + ":42.49,43.13 2 0\n"
+	a := NewConcurrentAccumulator(MergeSum)
+
+	const workers, adds = 16, 50
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < adds; j++ {
+				assert.NoError(t, a.Add(strings.NewReader(profile)))
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < adds; j++ {
+				snapshot := a.Snapshot()
+				if len(snapshot) == 0 {
+					continue
+				}
+				// a snapshot is never caught between the blocks of one profile
+				assert.Equal(t, 3, snapshot[0].NAllStmts)
+				snapshot[0].Blocks[0].Count = -1
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, "count", a.Mode())
+	list := a.Snapshot()
+	assert.Equal(t, 1, len(list))
+	assert.Equal(t, int64(workers*adds), list[0].Blocks[0].Count)
+	assert.Equal(t, int64(0), list[0].Blocks[1].Count)
+}
+
+func TestVerifyMerge(t *testing.T) {
+	profiles := []string{
+		"mode: count\na.go:1.1,2.2 2 1\na.go:3.1,4.2 3 0\nb.go:1.1,2.2 1 0\n",
+		"mode: count\na.go:1.1,2.2 2 0\na.go:3.1,4.2 3 4\nc.go:1.1,2.2 1 1\n",
+	}
+	acc := NewAccumulator(MergeSum)
+	var parts []*CoverageList
+	for _, p := range profiles {
+		assert.NoError(t, acc.Add(strings.NewReader(p)))
+		list, err := CovList(strings.NewReader(p))
+		assert.NoError(t, err)
+		parts = append(parts, &list)
+	}
+	merged := acc.List()
+	assert.NoError(t, VerifyMerge(&merged, parts))
+
+	corrupt := CoverageList{
+		{FileName: "a.go", NCoveredStmts: 3, NAllStmts: 5},
+		{FileName: "b.go", NCoveredStmts: 0, NAllStmts: 2},
+		{FileName: "d.go", NCoveredStmts: 0, NAllStmts: 1},
+	}
+	err := VerifyMerge(&corrupt, parts)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "a.go: 3 covered, expect 5")
+		assert.Contains(t, err.Error(), "b.go: 2 statements, expect 1")
+		assert.Contains(t, err.Error(), "c.go: missing in the merged profile")
+		assert.Contains(t, err.Error(), "d.go: not in any part")
+	}
+
+	// without blocks only the bounds of the covered statements are known
+	counts := []*CoverageList{
+		{{FileName: "a.go", NCoveredStmts: 2, NAllStmts: 5}},
+		{{FileName: "a.go", NCoveredStmts: 3, NAllStmts: 5}},
+	}
+	items := []struct {
+		covered   int
+		expectErr bool
+	}{
+		{covered: 2, expectErr: true},
+		{covered: 3, expectErr: false},
+		{covered: 5, expectErr: false},
+		{covered: 6, expectErr: true},
+	}
+	for _, tc := range items {
+		m := CoverageList{{FileName: "a.go", NCoveredStmts: tc.covered, NAllStmts: 5}}
+		assert.Equal(t, tc.expectErr, VerifyMerge(&m, counts) != nil, "covered %d", tc.covered)
+	}
+}
+
+func TestMergeStream(t *testing.T) {
+	in := make(chan io.Reader)
+	go func() {
+		in <- strings.NewReader("mode: count\na.go:1.1,2.2 2 1\n")
+		in <- strings.NewReader("mode: count\na.go:1.1,2.2 2 3\nb.go:1.1,2.2 1 0\n")
+		close(in)
+	}()
+	list, err := MergeStream(context.Background(), in)
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(*list)) {
+		assert.Equal(t, int64(4), (*list)[0].Blocks[0].Count)
+		assert.Equal(t, "66.7%", list.TotalPercentage())
+	}
+
+	// the partial result is returned on cancellation
+	ctx, cancel := context.WithCancel(context.Background())
+	in = make(chan io.Reader)
+	go func() {
+		in <- strings.NewReader("mode: count\na.go:1.1,2.2 2 1\n")
+		cancel()
+	}()
+	list, err = MergeStream(ctx, in)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, len(*list))
+
+	in = make(chan io.Reader, 2)
+	in <- strings.NewReader("mode: count\na.go:1.1,2.2 2 1\n")
+	in <- strings.NewReader("mode: count\nbad\n")
+	close(in)
+	list, err = MergeStream(context.Background(), in)
+	assert.Error(t, err)
+	assert.Equal(t, 1, len(*list))
+}
+
+func TestMergeLists(t *testing.T) {
+	a := CoverageList{
+		Coverage{FileName: "x.go", NCoveredStmts: 6, NAllStmts: 10, Blocks: []CoverBlock{{NumStmt: 10, Count: 1}}},
+		Coverage{FileName: "y.go", NCoveredStmts: 1, NAllStmts: 2},
+	}
+	// the instance compiles x.go with fewer statements, and does not cover y.go at all
+	b := CoverageList{
+		Coverage{FileName: "x.go", NCoveredStmts: 7, NAllStmts: 8},
+		Coverage{FileName: "z.go", NCoveredStmts: 0, NAllStmts: 3},
+	}
+	items := []struct {
+		policy MergePolicy
+		expect CoverageList
+	}{
+		{policy: MergeSum, expect: CoverageList{
+			Coverage{FileName: "x.go", NCoveredStmts: 13, NAllStmts: 18},
+			Coverage{FileName: "y.go", NCoveredStmts: 1, NAllStmts: 2},
+			Coverage{FileName: "z.go", NCoveredStmts: 0, NAllStmts: 3},
+		}},
+		{policy: MergeMax, expect: CoverageList{
+			Coverage{FileName: "x.go", NCoveredStmts: 7, NAllStmts: 10},
+			Coverage{FileName: "y.go", NCoveredStmts: 1, NAllStmts: 2},
+			Coverage{FileName: "z.go", NCoveredStmts: 0, NAllStmts: 3},
+		}},
+		{policy: MergeUnion, expect: CoverageList{
+			Coverage{FileName: "x.go", NCoveredStmts: 10, NAllStmts: 10},
+			Coverage{FileName: "y.go", NCoveredStmts: 1, NAllStmts: 2},
+			Coverage{FileName: "z.go", NCoveredStmts: 0, NAllStmts: 3},
+		}},
+	}
+	for _, tc := range items {
+		assert.Equal(t, tc.expect, MergeLists(tc.policy, a, b))
+	}
+	// the inputs are untouched
+	assert.Equal(t, 6, a[0].NCoveredStmts)
+	assert.Equal(t, 1, len(a[0].Blocks))
+}
+
+func TestLabeledAccumulator(t *testing.T) {
+	mainFile := "qiniu.com/kodo/apiserver/server/main.go"
+	svrFile := "qiniu.com/kodo/apiserver/server/svr.go"
+	a := NewLabeledAccumulator(MergeSum)
+	assert.NoError(t, a.Add("api", strings.NewReader("mode: count\n"+
+		mainFile+":32.49,33.13 1 30\n"+
+		svrFile+":42.49,43.13 1 0\n")))
+	assert.NoError(t, a.Add("e2e", strings.NewReader("mode: count\n"+
+		mainFile+":32.49,33.13 1 10\n"+
+		svrFile+":42.49,43.13 1 2\n")))
+	assert.NoError(t, a.Add("api", strings.NewReader("mode: count\n"+
+		mainFile+":32.49,33.13 1 1\n")))
+	assert.Error(t, a.Add("unit", strings.NewReader("mode: set\n"+mainFile+":32.49,33.13 1 1\n")))
+
+	assert.Equal(t, "count", a.Mode())
+	assert.Equal(t, map[string][]string{
+		mainFile: {"api", "e2e"},
+		svrFile:  {"e2e"},
+	}, a.Labels())
+	list := a.List()
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, int64(41), list[0].Blocks[0].Count)
+	assert.Equal(t, int64(2), list[1].Blocks[0].Count)
+}
+
+func TestNormalizeProfile(t *testing.T) {
+	profile := "mode: count\n" +
+		"qiniu.com\\kodo\\b.go:42.49,43.13 1 0\n" +
+		"qiniu.com/kodo/a.go:32.49,33.13 1 30\n" +
+		"qiniu.com/kodo/b.go:12.49,13.13 1 1\n" +
+		"mode: count\n" +
+		"qiniu.com/kodo/b.go:12.49,13.13 1 2\n" +
+		"qiniu.com/kodo/a.go:10.2,11.3 2 0\n"
+	expect := "mode: count\n" +
+		"qiniu.com/kodo/a.go:10.2,11.3 2 0\n" +
+		"qiniu.com/kodo/a.go:32.49,33.13 1 30\n" +
+		"qiniu.com/kodo/b.go:12.49,13.13 1 3\n" +
+		"qiniu.com/kodo/b.go:42.49,43.13 1 0\n"
+
+	var buf bytes.Buffer
+	assert.NoError(t, NormalizeProfile(strings.NewReader(profile), &buf))
+	assert.Equal(t, expect, buf.String())
+
+	// normalizing is idempotent
+	var again bytes.Buffer
+	assert.NoError(t, NormalizeProfile(strings.NewReader(buf.String()), &again))
+	assert.Equal(t, expect, again.String())
+
+	assert.Error(t, NormalizeProfile(strings.NewReader(profile+"mode: set\n"), &buf))
+}
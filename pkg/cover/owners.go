@@ -0,0 +1,121 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Unowned is the owner of the files matching no CODEOWNERS rule
+const Unowned = "unowned"
+
+// ParseCodeOwners parses a CODEOWNERS file into path -> owners rules.
+// Comments and lines without owners are ignored, a later rule of the same path wins.
+func ParseCodeOwners(r io.Reader) (map[string][]string, error) {
+	rules := make(map[string][]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		rules[fields[0]] = fields[1:]
+	}
+	return rules, scanner.Err()
+}
+
+// MatchOwners returns the owners of the file by the longest path prefix rule.
+// The rules are relative to the repo root while the file is usually an import path,
+// so a rule also matches when it is found after a path separator of the file.
+// "*" matches every file. Unowned is returned when no rule matches.
+func MatchOwners(owners map[string][]string, file string) []string {
+	var paths []string
+	for p := range owners {
+		paths = append(paths, p)
+	}
+	// equal prefixes, e.g. "/pkg" and "pkg", are resolved deterministically
+	sort.Strings(paths)
+
+	best := -1
+	var res []string
+	for _, p := range paths {
+		prefix := strings.TrimPrefix(p, "/")
+		if prefix == "*" {
+			prefix = ""
+		}
+		if len(prefix) > best && hasPathPrefix(file, prefix) {
+			best = len(prefix)
+			res = owners[p]
+		}
+	}
+	if best < 0 {
+		return []string{Unowned}
+	}
+	return res
+}
+
+func hasPathPrefix(file, prefix string) bool {
+	if prefix == "" {
+		return true
+	}
+	if strings.HasPrefix(file, prefix) && (strings.HasSuffix(prefix, "/") || len(file) == len(prefix) || file[len(prefix)] == '/') {
+		return true
+	}
+	i := strings.Index(file, "/"+prefix)
+	for i >= 0 {
+		rest := file[i+1:]
+		if strings.HasSuffix(prefix, "/") || len(rest) == len(prefix) || rest[len(prefix)] == '/' {
+			return true
+		}
+		next := strings.Index(file[i+1:], "/"+prefix)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false
+}
+
+// TeamCoverage sums the statements of the files of each owner into one Coverage per owner,
+// e.g. for per-team scorecards. The owners of a file are matched by MatchOwners, so a file
+// of multiple owners counts for each of them and the unmatched files go to Unowned.
+// A nil list has no team.
+func TeamCoverage(list *CoverageList, owners map[string][]string) map[string]*Coverage {
+	teams := make(map[string]*Coverage)
+	if list == nil {
+		return teams
+	}
+	for _, c := range *list {
+		for _, team := range MatchOwners(owners, c.Name()) {
+			t, ok := teams[team]
+			if !ok {
+				t = &Coverage{FileName: team}
+				teams[team] = t
+			}
+			t.NCoveredStmts += c.NCoveredStmts
+			t.NAllStmts += c.NAllStmts
+		}
+	}
+	return teams
+}
@@ -0,0 +1,110 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCodeOwners = `# comment
+/pkg/           @org/core
+/pkg/cover/     @org/cover @alice # inline comment
+docs/           @org/docs
+invalid
+`
+
+func TestParseCodeOwners(t *testing.T) {
+	owners, err := ParseCodeOwners(strings.NewReader(testCodeOwners))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"/pkg/":       {"@org/core"},
+		"/pkg/cover/": {"@org/cover", "@alice"},
+		"docs/":       {"@org/docs"},
+	}, owners)
+}
+
+func TestMatchOwners(t *testing.T) {
+	owners, err := ParseCodeOwners(strings.NewReader(testCodeOwners))
+	assert.NoError(t, err)
+
+	items := []struct {
+		file   string
+		expect []string
+	}{
+		{file: "github.com/qiniu/goc/pkg/cover/cover.go", expect: []string{"@org/cover", "@alice"}},
+		{file: "github.com/qiniu/goc/pkg/build/build.go", expect: []string{"@org/core"}},
+		{file: "pkg/prow/job.go", expect: []string{"@org/core"}},
+		{file: "github.com/qiniu/goc/cmd/diff.go", expect: []string{Unowned}},
+		{file: "github.com/qiniu/goc/mypkg/a.go", expect: []string{Unowned}},
+	}
+	for _, tc := range items {
+		assert.Equal(t, tc.expect, MatchOwners(owners, tc.file), tc.file)
+	}
+
+	owners["*"] = []string{"@org/all"}
+	assert.Equal(t, []string{"@org/all"}, MatchOwners(owners, "github.com/qiniu/goc/cmd/diff.go"))
+}
+
+func TestGenLocalCoverDiffReportOwners(t *testing.T) {
+	owners, err := ParseCodeOwners(strings.NewReader(testCodeOwners))
+	assert.NoError(t, err)
+	newList := CoverageList{
+		Coverage{FileName: "github.com/qiniu/goc/pkg/cover/cover.go", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: "github.com/qiniu/goc/cmd/diff.go", NCoveredStmts: 15, NAllStmts: 20},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "github.com/qiniu/goc/pkg/cover/cover.go", NCoveredStmts: 10, NAllStmts: 20},
+		Coverage{FileName: "github.com/qiniu/goc/cmd/diff.go", NCoveredStmts: 10, NAllStmts: 20},
+	}
+	opts := &DiffReportOptions{Owners: owners}
+
+	assert.Equal(t, []string{"File", "Base Coverage", "New Coverage", "Delta", "Owners"}, DiffReportHeader(opts))
+	assert.Equal(t, [][]string{
+		{"github.com/qiniu/goc/cmd/diff.go", "50.0%", "75.0%", "25.0%", Unowned},
+		{"github.com/qiniu/goc/pkg/cover/cover.go", "50.0%", "75.0%", "25.0%", "@org/cover @alice"},
+		{"Total", "50.0%", "75.0%", "25.0%", ""},
+	}, GenLocalCoverDiffReport(newList, baseList, opts))
+}
+
+func TestTeamCoverage(t *testing.T) {
+	owners, err := ParseCodeOwners(strings.NewReader(testCodeOwners))
+	assert.NoError(t, err)
+	list := CoverageList{
+		Coverage{FileName: "github.com/qiniu/goc/pkg/cover/cover.go", NCoveredStmts: 3, NAllStmts: 4},
+		Coverage{FileName: "github.com/qiniu/goc/pkg/build/build.go", NCoveredStmts: 1, NAllStmts: 4},
+		Coverage{FileName: "github.com/qiniu/goc/pkg/prow/job.go", NCoveredStmts: 2, NAllStmts: 2},
+		Coverage{FileName: "github.com/qiniu/goc/cmd/diff.go", NCoveredStmts: 0, NAllStmts: 2},
+	}
+	teams := TeamCoverage(&list, owners)
+
+	percentages := make(map[string]string)
+	for team, c := range teams {
+		assert.Equal(t, team, c.FileName)
+		percentages[team] = c.Percentage()
+	}
+	assert.Equal(t, map[string]string{
+		"@org/cover": "75.0%",
+		"@alice":     "75.0%",
+		"@org/core":  "50.0%",
+		Unowned:      "0.0%",
+	}, percentages)
+	assert.Empty(t, TeamCoverage(&CoverageList{}, owners))
+	assert.Empty(t, TeamCoverage(nil, owners))
+}
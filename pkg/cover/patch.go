@@ -0,0 +1,194 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseUnifiedDiff returns the lines added or modified per file of a unified diff,
+// the line numbers are of the new file and the deleted files are left out
+func ParseUnifiedDiff(r io.Reader) (map[string][]int, error) {
+	changed := make(map[string][]int)
+	var file string
+	var oldLeft, newLeft, line int
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if oldLeft > 0 || newLeft > 0 {
+			// inside a hunk, so a line starting with "+++" is content rather than a header
+			switch {
+			case strings.HasPrefix(text, "+"):
+				if file != "" {
+					changed[file] = append(changed[file], line)
+				}
+				line++
+				newLeft--
+			case strings.HasPrefix(text, "-"):
+				oldLeft--
+			case strings.HasPrefix(text, "\\"):
+				// "\ No newline at end of file"
+			default:
+				line++
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(strings.TrimSpace(text[4:]), "b/")
+			if file == "/dev/null" {
+				file = ""
+			}
+		case strings.HasPrefix(text, "@@ "):
+			var err error
+			oldLeft, line, newLeft, err = parseHunkHeader(text)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return changed, nil
+}
+
+// parseHunkHeader parses "@@ -l,s +l,s @@", a missing size is 1
+func parseHunkHeader(text string) (oldSize, newStart, newSize int, err error) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, 0, fmt.Errorf("the hunk header %s is not expected", text)
+	}
+	if _, oldSize, err = parseRange(fields[1][1:]); err != nil {
+		return 0, 0, 0, fmt.Errorf("the hunk header %s is not expected", text)
+	}
+	if newStart, newSize, err = parseRange(fields[2][1:]); err != nil {
+		return 0, 0, 0, fmt.Errorf("the hunk header %s is not expected", text)
+	}
+	return oldSize, newStart, newSize, nil
+}
+
+func parseRange(s string) (start, size int, err error) {
+	size = 1
+	if i := strings.Index(s, ","); i >= 0 {
+		if size, err = strconv.Atoi(s[i+1:]); err != nil {
+			return 0, 0, err
+		}
+		s = s[:i]
+	}
+	start, err = strconv.Atoi(s)
+	return start, size, err
+}
+
+// PatchCoverage returns the coverage of the blocks containing a changed line, per file.
+// The changed files are relative to the repo root while the profile has the import paths,
+// so they are joined to modulePath, the module path of the go.mod at the repo root, and
+// matched exactly. An empty modulePath matches the changed files as they are.
+// The files without a changed statement are left out, a nil list has no file.
+func PatchCoverage(list *CoverageList, changed map[string][]int, modulePath string) CoverageList {
+	byImportPath := make(map[string][]int, len(changed))
+	for file, lines := range changed {
+		name := path.Join(modulePath, file)
+		byImportPath[name] = append(byImportPath[name], lines...)
+	}
+	for _, lines := range byImportPath {
+		sort.Ints(lines)
+	}
+
+	res := NewCoverageList()
+	if list == nil {
+		return res
+	}
+	for _, c := range *list {
+		lines := byImportPath[c.FileName]
+		if len(lines) == 0 {
+			continue
+		}
+		patch := Coverage{FileName: c.FileName, Mode: c.Mode}
+		for _, b := range c.Blocks {
+			if !containsLine(lines, b.StartLine, b.EndLine) {
+				continue
+			}
+			patch.NAllStmts += b.NumStmt
+			if b.Count > 0 {
+				patch.NCoveredStmts += b.NumStmt
+			}
+			patch.Blocks = append(patch.Blocks, b)
+		}
+		if patch.NAllStmts > 0 {
+			res = append(res, patch)
+		}
+	}
+	return res
+}
+
+// AuthorCoverage returns the patch coverage of the lines of author, given the author of
+// each line per file, e.g. from git blame, so that an engineer gets the coverage of
+// their own code. The files are matched to modulePath like PatchCoverage.
+func AuthorCoverage(list *CoverageList, lineAuthors map[string]map[int]string, author string, modulePath string) CoverageList {
+	lines := make(map[string][]int)
+	for file, authors := range lineAuthors {
+		for line, a := range authors {
+			if a == author {
+				lines[file] = append(lines[file], line)
+			}
+		}
+	}
+	return PatchCoverage(list, lines, modulePath)
+}
+
+// containsLine reports whether any of the sorted lines is in [start, end]
+func containsLine(lines []int, start, end int) bool {
+	i := sort.SearchInts(lines, start)
+	return i < len(lines) && lines[i] <= end
+}
+
+// ChangedFilesCoverage returns the patch coverage of the lines changed from baseRef to
+// headRef in the git repo at repoDir, see PatchCoverage, with the module path of the
+// go.mod at repoDir. The working tree is compared with baseRef when headRef is empty.
+func ChangedFilesCoverage(list *CoverageList, repoDir, baseRef, headRef string) (CoverageList, error) {
+	// fixed prefixes whatever diff.noprefix or diff.mnemonicPrefix say, and the refs,
+	// which may come from a PR, are never read as options
+	args := []string{"diff", "--no-color", "--no-ext-diff", "--unified=0", "--src-prefix=a/", "--dst-prefix=b/", "--end-of-options", baseRef}
+	if headRef != "" {
+		args = append(args, headRef)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Dir = repoDir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git diff %s %s failed: %v, %s", baseRef, headRef, err, strings.TrimSpace(stderr.String()))
+	}
+	changed, err := ParseUnifiedDiff(bytes.NewReader(out))
+	if err != nil {
+		return nil, err
+	}
+	return PatchCoverage(list, changed, modulePathOf(repoDir)), nil
+}
@@ -0,0 +1,237 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testUnifiedDiff = `diff --git a/pkg/foo/foo.go b/pkg/foo/foo.go
+index 1111111..2222222 100644
+--- a/pkg/foo/foo.go
++++ b/pkg/foo/foo.go
+@@ -3,0 +4,2 @@ package foo
++++i
++	j++
+@@ -10 +12 @@ func Foo() {
+-	return 1
++	return 2
+diff --git a/pkg/foo/bar.go b/pkg/foo/bar.go
+deleted file mode 100644
+--- a/pkg/foo/bar.go
++++ /dev/null
+@@ -1,2 +0,0 @@
+-package foo
+-
+diff --git a/README.md b/README.md
+--- a/README.md
++++ b/README.md
+@@ -1 +1,2 @@
+ # foo
++bar
+\ No newline at end of file
+`
+
+func TestParseUnifiedDiff(t *testing.T) {
+	changed, err := ParseUnifiedDiff(strings.NewReader(testUnifiedDiff))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]int{
+		"pkg/foo/foo.go": {4, 5, 12},
+		"README.md":      {2},
+	}, changed)
+
+	_, err = ParseUnifiedDiff(strings.NewReader("+++ b/foo.go\n@@ -a +1 @@\n"))
+	assert.Error(t, err)
+}
+
+func TestPatchCoverage(t *testing.T) {
+	fileName := "github.com/qiniu/foo/pkg/foo/foo.go"
+	list := CoverageList{
+		Coverage{FileName: fileName, NCoveredStmts: 2, NAllStmts: 4, Mode: "set", Blocks: []CoverBlock{
+			{FileName: fileName, StartLine: 1, EndLine: 3, NumStmt: 1, Count: 1},
+			{FileName: fileName, StartLine: 4, EndLine: 6, NumStmt: 2, Count: 0},
+			{FileName: fileName, StartLine: 11, EndLine: 13, NumStmt: 1, Count: 1},
+		}},
+		Coverage{FileName: "github.com/qiniu/foo/pkg/bar/bar.go", NCoveredStmts: 1, NAllStmts: 1},
+	}
+	items := []struct {
+		changed map[string][]int
+		expect  []string
+	}{
+		{changed: map[string][]int{"pkg/foo/foo.go": {5, 12}}, expect: []string{"33.3%"}},
+		{changed: map[string][]int{"./pkg/foo/foo.go": {5, 12}}, expect: []string{"33.3%"}},
+		{changed: map[string][]int{"oo/foo.go": {5, 12}}, expect: nil},
+		{changed: map[string][]int{"foo/foo.go": {5, 12}}, expect: nil},
+		{changed: map[string][]int{"pkg/foo/foo.go": {8}}, expect: nil},
+		{changed: map[string][]int{}, expect: nil},
+	}
+	for _, tc := range items {
+		var res []string
+		patch := PatchCoverage(&list, tc.changed, "github.com/qiniu/foo")
+		for i := range patch {
+			res = append(res, patch[i].Percentage())
+		}
+		assert.Equal(t, tc.expect, res)
+	}
+
+	assert.Empty(t, PatchCoverage(&list, map[string][]int{"pkg/foo/foo.go": {5, 12}}, ""))
+	assert.Empty(t, PatchCoverage(nil, map[string][]int{"pkg/foo/foo.go": {5, 12}}, "github.com/qiniu/foo"))
+	assert.Equal(t, 1, len(PatchCoverage(&list, map[string][]int{fileName: {5, 12}}, "")))
+}
+
+func TestPatchCoverageSameBaseName(t *testing.T) {
+	block := func(name string, count int64) Coverage {
+		return Coverage{FileName: name, NCoveredStmts: int(count), NAllStmts: 1, Blocks: []CoverBlock{
+			{FileName: name, StartLine: 1, EndLine: 3, NumStmt: 1, Count: count},
+		}}
+	}
+	list := CoverageList{block("ex.com/m/main.go", 0), block("ex.com/m/cmd/a/main.go", 1)}
+
+	patch := PatchCoverage(&list, map[string][]int{"main.go": {2}}, "ex.com/m")
+	if assert.Equal(t, 1, len(patch)) {
+		assert.Equal(t, "ex.com/m/main.go", patch[0].FileName)
+		assert.Equal(t, "0.0%", patch.TotalPercentage())
+	}
+	patch = PatchCoverage(&list, map[string][]int{"cmd/a/main.go": {2}}, "ex.com/m")
+	if assert.Equal(t, 1, len(patch)) {
+		assert.Equal(t, "ex.com/m/cmd/a/main.go", patch[0].FileName)
+	}
+}
+
+func TestAuthorCoverage(t *testing.T) {
+	fileName := "github.com/qiniu/foo/pkg/foo/foo.go"
+	list := CoverageList{
+		Coverage{FileName: fileName, NCoveredStmts: 2, NAllStmts: 4, Mode: "set", Blocks: []CoverBlock{
+			{FileName: fileName, StartLine: 1, EndLine: 3, NumStmt: 1, Count: 1},
+			{FileName: fileName, StartLine: 4, EndLine: 6, NumStmt: 2, Count: 0},
+			{FileName: fileName, StartLine: 11, EndLine: 13, NumStmt: 1, Count: 1},
+		}},
+	}
+	lineAuthors := map[string]map[int]string{
+		"pkg/foo/foo.go": {2: "alice", 5: "bob", 12: "alice"},
+	}
+	items := []struct {
+		author      string
+		expectStmts int
+		expect      string
+	}{
+		{author: "alice", expectStmts: 2, expect: "100.0%"},
+		{author: "bob", expectStmts: 2, expect: "0.0%"},
+	}
+	for _, tc := range items {
+		res := AuthorCoverage(&list, lineAuthors, tc.author, "github.com/qiniu/foo")
+		assert.Equal(t, 1, len(res))
+		assert.Equal(t, tc.expectStmts, res[0].NAllStmts)
+		assert.Equal(t, tc.expect, res[0].Percentage())
+	}
+	assert.Empty(t, AuthorCoverage(&list, lineAuthors, "carol", "github.com/qiniu/foo"))
+	assert.Empty(t, AuthorCoverage(nil, lineAuthors, "alice", "github.com/qiniu/foo"))
+}
+
+func TestAuthorCoverageSameBaseName(t *testing.T) {
+	list := CoverageList{}
+	for _, name := range []string{"ex.com/m/main.go", "ex.com/m/cmd/a/main.go"} {
+		list = append(list, Coverage{FileName: name, NCoveredStmts: 1, NAllStmts: 2, Blocks: []CoverBlock{
+			{FileName: name, StartLine: 1, EndLine: 3, NumStmt: 1, Count: 1},
+			{FileName: name, StartLine: 4, EndLine: 6, NumStmt: 1, Count: 0},
+		}})
+	}
+	lineAuthors := map[string]map[int]string{
+		"main.go":       {2: "alice", 5: "bob"},
+		"cmd/a/main.go": {2: "bob", 5: "bob"},
+	}
+
+	res := AuthorCoverage(&list, lineAuthors, "alice", "ex.com/m")
+	if assert.Equal(t, 1, len(res)) {
+		assert.Equal(t, "ex.com/m/main.go", res[0].FileName)
+		assert.Equal(t, "100.0%", res[0].Percentage())
+	}
+	res = AuthorCoverage(&list, lineAuthors, "bob", "ex.com/m")
+	if assert.Equal(t, 2, len(res)) {
+		assert.Equal(t, "ex.com/m/main.go", res[0].FileName)
+		assert.Equal(t, 1, res[0].NAllStmts)
+		assert.Equal(t, "ex.com/m/cmd/a/main.go", res[1].FileName)
+		assert.Equal(t, 2, res[1].NAllStmts)
+	}
+}
+
+func TestChangedFilesCoverage(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not found")
+	}
+	dir, err := ioutil.TempDir("", "goc-patch-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=goc", "-c", "user.email=goc@qiniu.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	source := filepath.Join(dir, "foo.go")
+	git("init", "-q")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module github.com/qiniu/foo\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(source, []byte("package foo\n\nfunc Foo() int {\n\treturn 1\n}\n"), 0644))
+	git("add", "foo.go")
+	git("commit", "-q", "-m", "base")
+	assert.NoError(t, ioutil.WriteFile(source, []byte("package foo\n\nfunc Foo() int {\n\treturn 2\n}\n"), 0644))
+	git("commit", "-q", "-a", "-m", "head")
+
+	fileName := "github.com/qiniu/foo/foo.go"
+	list := CoverageList{
+		Coverage{FileName: fileName, NCoveredStmts: 1, NAllStmts: 1, Blocks: []CoverBlock{
+			{FileName: fileName, StartLine: 3, EndLine: 5, NumStmt: 1, Count: 3},
+		}},
+	}
+	patch, err := ChangedFilesCoverage(&list, dir, "HEAD~1", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(patch))
+	assert.Equal(t, "100.0%", patch.TotalPercentage())
+
+	patch, err = ChangedFilesCoverage(&list, dir, "HEAD", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(patch))
+
+	_, err = ChangedFilesCoverage(&list, dir, "no-such-ref", "HEAD")
+	assert.Error(t, err)
+
+	// a ref is not an option
+	output := filepath.Join(dir, "output.diff")
+	_, err = ChangedFilesCoverage(&list, dir, "--output="+output, "HEAD")
+	assert.Error(t, err)
+	_, err = os.Stat(output)
+	assert.True(t, os.IsNotExist(err))
+
+	// the paths keep their prefix whatever the diff config of the repo
+	git("config", "diff.noprefix", "true")
+	patch, err = ChangedFilesCoverage(&list, dir, "HEAD~1", "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(patch))
+	git("config", "diff.noprefix", "false")
+	git("config", "diff.mnemonicPrefix", "true")
+	patch, err = ChangedFilesCoverage(&list, dir, "HEAD~1", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(patch))
+}
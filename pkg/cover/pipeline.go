@@ -0,0 +1,126 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"strings"
+)
+
+// Transform is a stage of a Pipeline, it may modify the list in place and return it
+type Transform func(list *CoverageList) *CoverageList
+
+// FileStage is a per-file stage of a Pipeline, it modifies the file in place and returns
+// false to drop it. The blocks are shared with the input list, so a stage modifying them
+// must copy them first, like TrimFilePrefix.
+type FileStage func(c *Coverage) bool
+
+// Pipeline applies a sequence of transforms to a list, e.g. to prepare it for a report.
+// The input list is copied once, and consecutive file stages run in a single pass over it.
+type Pipeline struct {
+	stages []pipelineStage
+}
+
+// pipelineStage is either a Transform or a run of FileStages
+type pipelineStage struct {
+	transform Transform
+	files     []FileStage
+}
+
+// NewPipeline creates a Pipeline of the transforms
+func NewPipeline(transforms ...Transform) *Pipeline {
+	p := &Pipeline{}
+	for _, t := range transforms {
+		p.Then(t)
+	}
+	return p
+}
+
+// Then appends a transform to the pipeline
+func (p *Pipeline) Then(t Transform) *Pipeline {
+	p.stages = append(p.stages, pipelineStage{transform: t})
+	return p
+}
+
+// EachFile appends file stages to the pipeline, merged with the file stages before them
+func (p *Pipeline) EachFile(stages ...FileStage) *Pipeline {
+	if n := len(p.stages); n > 0 && p.stages[n-1].transform == nil {
+		p.stages[n-1].files = append(p.stages[n-1].files, stages...)
+		return p
+	}
+	p.stages = append(p.stages, pipelineStage{files: stages})
+	return p
+}
+
+// Apply runs the pipeline on a copy of the list, which is left untouched
+func (p *Pipeline) Apply(list *CoverageList) *CoverageList {
+	res := make(CoverageList, len(*list))
+	copy(res, *list)
+	cur := &res
+	for _, s := range p.stages {
+		if s.transform != nil {
+			cur = s.transform(cur)
+			continue
+		}
+		// compact in place, the kept files never outrun the scanned ones
+		kept := (*cur)[:0]
+		for _, c := range *cur {
+			if applyFileStages(&c, s.files) {
+				kept = append(kept, c)
+			}
+		}
+		*cur = kept
+	}
+	return cur
+}
+
+func applyFileStages(c *Coverage, stages []FileStage) bool {
+	for _, stage := range stages {
+		if !stage(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// TrimFilePrefix returns a FileStage trimming prefix from the names of the file and its blocks
+func TrimFilePrefix(prefix string) FileStage {
+	return func(c *Coverage) bool {
+		if !strings.HasPrefix(c.FileName, prefix) {
+			return true
+		}
+		c.FileName = strings.TrimPrefix(c.FileName, prefix)
+		blocks := make([]CoverBlock, len(c.Blocks))
+		for i, b := range c.Blocks {
+			b.FileName = strings.TrimPrefix(b.FileName, prefix)
+			blocks[i] = b
+		}
+		if c.Blocks != nil {
+			c.Blocks = blocks
+		}
+		return true
+	}
+}
+
+// ExcludeTestFiles is a FileStage dropping the _test.go files
+func ExcludeTestFiles(c *Coverage) bool {
+	return !strings.HasSuffix(c.FileName, "_test.go")
+}
+
+// ExcludeVendored is a FileStage dropping the files under a vendor directory
+func ExcludeVendored(c *Coverage) bool {
+	return !strings.HasPrefix(c.FileName, "vendor/") && !strings.Contains(c.FileName, "/vendor/")
+}
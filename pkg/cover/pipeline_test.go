@@ -0,0 +1,78 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPipeline(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/a.go", NCoveredStmts: 1, NAllStmts: 2, Blocks: []CoverBlock{
+			{FileName: "qiniu.com/kodo/a.go", NumStmt: 2, Count: 1},
+		}},
+		Coverage{FileName: "qiniu.com/kodo/a_test.go", NCoveredStmts: 1, NAllStmts: 1},
+		Coverage{FileName: "qiniu.com/kodo/vendor/x/x.go", NCoveredStmts: 0, NAllStmts: 5},
+		Coverage{FileName: "qiniu.com/kodo/b/b.go", NCoveredStmts: 3, NAllStmts: 4},
+		Coverage{FileName: "other.com/c.go", NCoveredStmts: 0, NAllStmts: 0},
+	}
+
+	var seen int
+	countFiles := func(list *CoverageList) *CoverageList {
+		seen = len(*list)
+		return list
+	}
+	p := NewPipeline().
+		EachFile(ExcludeTestFiles, ExcludeVendored).
+		EachFile(TrimFilePrefix("qiniu.com/kodo/")).
+		Then(countFiles).
+		Then(func(list *CoverageList) *CoverageList {
+			grouped := list.GroupByPackage()
+			return &grouped
+		})
+	res := p.Apply(&list)
+
+	assert.Equal(t, 3, seen)
+	assert.Equal(t, 3, len(*res))
+	assert.Equal(t, ".", (*res)[0].FileName)
+	assert.Equal(t, "b", (*res)[1].FileName)
+	assert.Equal(t, "other.com", (*res)[2].FileName)
+	assert.Equal(t, "a.go", (*res)[0].Blocks[0].FileName)
+	// the file stages are merged into one stage
+	assert.Equal(t, 3, len(p.stages))
+
+	// the input list is left untouched
+	assert.Equal(t, 5, len(list))
+	assert.Equal(t, "qiniu.com/kodo/a.go", list[0].FileName)
+	assert.Equal(t, "qiniu.com/kodo/a.go", list[0].Blocks[0].FileName)
+
+	assert.Equal(t, list, *NewPipeline().Apply(&list))
+}
+
+func TestExcludeVendored(t *testing.T) {
+	items := map[string]bool{
+		"vendor/x/x.go":           false,
+		"qiniu.com/vendor/x/x.go": false,
+		"qiniu.com/vendors/x.go":  true,
+		"qiniu.com/x/vendor.go":   true,
+	}
+	for name, expect := range items {
+		assert.Equal(t, expect, ExcludeVendored(&Coverage{FileName: name}), name)
+	}
+}
@@ -0,0 +1,447 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+const (
+	// CrossedBelow flags a file whose coverage dropped below the threshold
+	CrossedBelow = "dropped below"
+	// CrossedAbove flags a file whose coverage rose above the threshold
+	CrossedAbove = "rose above"
+)
+
+// DiffColumn is a column of the diff report, its value is the header of the column
+type DiffColumn string
+
+const (
+	ColumnFile      DiffColumn = "File"
+	ColumnBase      DiffColumn = "Base Coverage"
+	ColumnNew       DiffColumn = "New Coverage"
+	ColumnDelta     DiffColumn = "Delta"
+	ColumnDeltaBP   DiffColumn = "Delta (bp)"
+	ColumnThreshold DiffColumn = "Threshold"
+	ColumnBaseStmts DiffColumn = "Base Statements"
+	ColumnNewStmts  DiffColumn = "New Statements"
+	ColumnOwners    DiffColumn = "Owners"
+)
+
+// DiffReportOptions customizes the diff report of two local profiles
+type DiffReportOptions struct {
+	// Columns is the order of the columns in the rows, the default is
+	// File, Base, New, Delta, followed by Delta (bp) if BasisPoints is set, by Base Statements
+	// and New Statements if ShowStmts is set, by Threshold if FlagCrossings is set, and by Owners if Owners is set
+	Columns []DiffColumn
+	// BasisPoints adds the delta in integer basis points, see Coverage.BasisPoints
+	BasisPoints bool
+	// ShowStmts adds the covered/total statement counts of base and new
+	ShowStmts bool
+	// Owners, e.g. parsed by ParseCodeOwners, appends a column of the owners of each file
+	Owners map[string][]string
+	// MinStmts omits the files with fewer statements in both lists, whose tiny edits flip
+	// the coverage between 0% and 100%. The Total row still counts every file, so it
+	// stays the same as the totals reported elsewhere.
+	MinStmts int
+	// Renames maps the new names of renamed files to their old names, so that a renamed
+	// file is compared against its base counterpart instead of showing up as added and
+	// removed. The other files are matched by their names.
+	Renames map[string]string
+	// Intersection only compares the files in both lists, the Total row included, so that
+	// added and removed files do not show up as coverage movement and "None" never appears
+	Intersection bool
+	// FlagCrossings adds a column flagging the files whose base and new coverage
+	// are on opposite sides of CrossThreshold
+	FlagCrossings  bool
+	CrossThreshold float32
+	// ValuePrecision is the number of decimals of the base and new columns, and
+	// DeltaPrecision the one of the delta column. nil keeps the default, which is
+	// one decimal through the percentage formatter for values and one decimal for deltas.
+	ValuePrecision *int
+	DeltaPrecision *int
+}
+
+// DiffReportHeader returns the header matching the rows of GenLocalCoverDiffReport
+func DiffReportHeader(opts *DiffReportOptions) []string {
+	if opts == nil {
+		opts = &DiffReportOptions{}
+	}
+	var header []string
+	for _, col := range opts.columns() {
+		header = append(header, string(col))
+	}
+	return header
+}
+
+// GenLocalCoverDiffReport generates the rows of the diff report between two local profiles,
+// files with unchanged coverage at the delta precision, and in basis points if shown, are omitted and the last row is the total.
+// opts can be nil for the default report.
+func GenLocalCoverDiffReport(newList CoverageList, baseList CoverageList, opts *DiffReportOptions) [][]string {
+	if opts == nil {
+		opts = &DiffReportOptions{}
+	}
+	if len(opts.Renames) > 0 {
+		baseList = renameBase(baseList, opts.Renames)
+	}
+	if opts.Intersection {
+		newList, baseList = intersect(newList, baseList), intersect(baseList, newList)
+	}
+	newMap := newList.Map()
+	baseMap := baseList.Map()
+	bases := make(map[string]diffSide, len(baseMap))
+	for file, c := range baseMap {
+		bases[file] = coverageSide(c)
+	}
+	baseTotal := diffSide{present: true, stmts: true}
+	baseTotal.covered, baseTotal.all = baseList.totalStmts()
+	baseTotal.ratio, baseTotal.valid = ratioOf(baseList.TotalRatio())
+	return opts.report(newList, newMap, bases, baseTotal)
+}
+
+// TotalRatioKey is the key of the total ratio in the base of GenRatioDiffReport
+const TotalRatioKey = "Total"
+
+// RatioMap returns the ratio of each file with statements and the total ratio keyed by
+// TotalRatioKey, e.g. to store a rolling average as the base of GenRatioDiffReport
+func (g CoverageList) RatioMap() map[string]float32 {
+	ratios := make(map[string]float32, len(g)+1)
+	for _, c := range g {
+		if ratio, err := c.Ratio(); err == nil {
+			ratios[c.Name()] = ratio
+		}
+	}
+	if ratio, err := g.TotalRatio(); err == nil {
+		ratios[TotalRatioKey] = ratio
+	}
+	return ratios
+}
+
+// GenRatioDiffReport generates the rows of the diff report like GenLocalCoverDiffReport, but
+// against the ratios of the base files, e.g. a rolling average of the main branch, instead
+// of a full base list. The Total row compares with the entry of TotalRatioKey, "None" if
+// missing. As the base has no statement counts, they are "None", MinStmts only checks
+// the new files, and with Intersection the base total is still the stored one.
+func GenRatioDiffReport(newList CoverageList, baseRatios map[string]float32, opts *DiffReportOptions) [][]string {
+	if opts == nil {
+		opts = &DiffReportOptions{}
+	}
+	bases := make(map[string]diffSide, len(baseRatios))
+	for file, ratio := range baseRatios {
+		if file != TotalRatioKey {
+			bases[file] = diffSide{present: true, valid: true, ratio: ratio}
+		}
+	}
+	if len(opts.Renames) > 0 {
+		for newName, oldName := range opts.Renames {
+			b, ok := bases[oldName]
+			if _, exists := bases[newName]; ok && !exists {
+				delete(bases, oldName)
+				bases[newName] = b
+			}
+		}
+	}
+	newMap := newList.Map()
+	if opts.Intersection {
+		newList = NewCoverageList()
+		for _, c := range newMap {
+			if _, ok := bases[c.Name()]; ok {
+				newList = append(newList, c)
+			}
+		}
+		newList.Sort()
+		newMap = newList.Map()
+		for file := range bases {
+			if _, ok := newMap[file]; !ok {
+				delete(bases, file)
+			}
+		}
+	}
+	baseTotal := diffSide{}
+	if ratio, ok := baseRatios[TotalRatioKey]; ok {
+		baseTotal = diffSide{present: true, valid: true, ratio: ratio}
+	}
+	return opts.report(newList, newMap, bases, baseTotal)
+}
+
+// diffSide is the base or new coverage of a row of the diff report
+type diffSide struct {
+	present bool // the file is in the list
+	valid   bool // the ratio is available
+	ratio   float32
+	stmts   bool // the statement counts are known
+	covered int
+	all     int
+}
+
+func coverageSide(c Coverage) diffSide {
+	side := diffSide{present: true, stmts: true, covered: c.NCoveredStmts, all: c.NAllStmts}
+	side.ratio, side.valid = ratioOf(c.Ratio())
+	return side
+}
+
+func ratioOf(ratio float32, err error) (float32, bool) {
+	return ratio, err == nil
+}
+
+// basisPoints returns the ratio in basis points, from the statements if known
+func (s diffSide) basisPoints() int {
+	if s.stmts {
+		return scaledRatio(s.covered, s.all, 10000)
+	}
+	if !s.valid {
+		return 0
+	}
+	// tolerate the float32 error of the ratio, e.g. 0.7 is slightly below it
+	return int(math.Floor(float64(s.ratio)*10000 + 1e-3))
+}
+
+// value returns the ratio column of the side
+func (opts *DiffReportOptions) value(s diffSide) string {
+	if !s.present {
+		return "None"
+	}
+	return opts.valueStr(s.ratio, s.valid)
+}
+
+func stmtsOf(s diffSide) string {
+	if !s.present || !s.stmts {
+		return "None"
+	}
+	return stmtsStr(s.covered, s.all)
+}
+
+// delta returns the delta of the ratios, a missing or unavailable ratio counts as 0
+func delta(n, b diffSide) float32 {
+	var newRatio, baseRatio float32
+	if n.valid {
+		newRatio = n.ratio
+	}
+	if b.valid {
+		baseRatio = b.ratio
+	}
+	return newRatio - baseRatio
+}
+
+// report generates the rows of the diff report of the new files against the base sides
+func (opts *DiffReportOptions) report(newList CoverageList, newMap map[string]Coverage, bases map[string]diffSide, baseTotal diffSide) [][]string {
+	var files []string
+	for file := range newMap {
+		files = append(files, file)
+	}
+	for file := range bases {
+		if _, ok := newMap[file]; !ok {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	var rows [][]string
+	for _, file := range files {
+		var n diffSide
+		if c, ok := newMap[file]; ok {
+			n = coverageSide(c)
+		}
+		b := bases[file]
+		if n.all < opts.MinStmts && b.all < opts.MinStmts {
+			continue
+		}
+		row := map[DiffColumn]string{
+			ColumnFile:  file,
+			ColumnBase:  opts.value(b),
+			ColumnNew:   opts.value(n),
+			ColumnDelta: opts.deltaStr(delta(n, b)),
+		}
+		bpDelta := n.basisPoints() - b.basisPoints()
+		// a movement below the delta precision still shows up in basis points
+		if opts.roundDelta(delta(n, b)) == 0 && (!opts.BasisPoints || bpDelta == 0) {
+			continue
+		}
+		row[ColumnDeltaBP] = basisPointsDeltaStr(bpDelta)
+		row[ColumnBaseStmts], row[ColumnNewStmts] = stmtsOf(b), stmtsOf(n)
+		if opts.FlagCrossings {
+			row[ColumnThreshold] = sideCrossing(n, b, opts.CrossThreshold)
+		}
+		if opts.Owners != nil {
+			row[ColumnOwners] = strings.Join(MatchOwners(opts.Owners, file), " ")
+		}
+		rows = append(rows, opts.project(row))
+	}
+
+	newTotal := diffSide{present: true, stmts: true}
+	newTotal.covered, newTotal.all = newList.totalStmts()
+	newTotal.ratio, newTotal.valid = ratioOf(newList.TotalRatio())
+	total := map[DiffColumn]string{
+		ColumnFile:  "Total",
+		ColumnBase:  opts.value(baseTotal),
+		ColumnNew:   opts.value(newTotal),
+		ColumnDelta: opts.deltaStr(delta(newTotal, baseTotal)),
+	}
+	total[ColumnDeltaBP] = basisPointsDeltaStr(newTotal.basisPoints() - baseTotal.basisPoints())
+	total[ColumnBaseStmts] = stmtsOf(baseTotal)
+	total[ColumnNewStmts] = stmtsOf(newTotal)
+	if opts.FlagCrossings {
+		total[ColumnThreshold] = sideCrossing(newTotal, baseTotal, opts.CrossThreshold)
+	}
+	return append(rows, opts.project(total))
+}
+
+// renameBase returns a copy of the base list whose renamed files carry their new names,
+// unless the base already has a file of the new name
+func renameBase(baseList CoverageList, renames map[string]string) CoverageList {
+	newNames := make(map[string]string, len(renames))
+	for newName, oldName := range renames {
+		newNames[oldName] = newName
+	}
+	baseMap := baseList.Map()
+	res := make(CoverageList, len(baseList))
+	for i, c := range baseList {
+		if newName, ok := newNames[c.Name()]; ok {
+			if _, exists := baseMap[newName]; !exists {
+				c.FileName = newName
+			}
+		}
+		res[i] = c
+	}
+	return res
+}
+
+// intersect returns the entries of g whose file is also in other
+func intersect(g, other CoverageList) CoverageList {
+	otherMap := other.Map()
+	res := NewCoverageList()
+	for _, c := range g {
+		if _, ok := otherMap[c.Name()]; ok {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+func (opts *DiffReportOptions) columns() []DiffColumn {
+	if len(opts.Columns) > 0 {
+		return opts.Columns
+	}
+	cols := []DiffColumn{ColumnFile, ColumnBase, ColumnNew, ColumnDelta}
+	if opts.BasisPoints {
+		cols = append(cols, ColumnDeltaBP)
+	}
+	if opts.ShowStmts {
+		cols = append(cols, ColumnBaseStmts, ColumnNewStmts)
+	}
+	if opts.FlagCrossings {
+		cols = append(cols, ColumnThreshold)
+	}
+	if opts.Owners != nil {
+		cols = append(cols, ColumnOwners)
+	}
+	return cols
+}
+
+// project orders the values of a row by the columns
+func (opts *DiffReportOptions) project(row map[DiffColumn]string) []string {
+	var res []string
+	for _, col := range opts.columns() {
+		res = append(res, row[col])
+	}
+	return res
+}
+
+// basisPointsDeltaStr formats a delta in basis points with its sign, e.g. "+12" or "-3"
+func basisPointsDeltaStr(delta int) string {
+	if delta == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%+d", delta)
+}
+
+func stmtsStr(covered, all int) string {
+	return fmt.Sprintf("%d/%d", covered, all)
+}
+
+func (opts *DiffReportOptions) valueStr(ratio float32, valid bool) string {
+	if opts.ValuePrecision == nil {
+		return percentageFormatter(ratio, valid)
+	}
+	if !valid {
+		return "N/A"
+	}
+	return percentStrWithPrecision(ratio, *opts.ValuePrecision)
+}
+
+// roundDelta returns the delta in percent rounded to the delta precision
+func (opts *DiffReportOptions) roundDelta(delta float32) float64 {
+	precision := 1
+	if opts.DeltaPrecision != nil {
+		precision = *opts.DeltaPrecision
+	}
+	return roundPercent(delta, precision)
+}
+
+func (opts *DiffReportOptions) deltaStr(delta float32) string {
+	precision := 1
+	if opts.DeltaPrecision != nil {
+		precision = *opts.DeltaPrecision
+	}
+	return fmt.Sprintf("%.*f%%", precision, roundPercent(delta, precision))
+}
+
+func sideCrossing(n, b diffSide, threshold float32) string {
+	if !n.valid || !b.valid {
+		return ""
+	}
+	return crossing(n.ratio, b.ratio, threshold)
+}
+
+func crossing(newRatio, baseRatio, threshold float32) string {
+	switch {
+	case baseRatio >= threshold && newRatio < threshold:
+		return CrossedBelow
+	case baseRatio < threshold && newRatio >= threshold:
+		return CrossedAbove
+	}
+	return ""
+}
+
+// GenModuleDiffReports generates the diff report of every module of a multi-module repo,
+// the reports are keyed by module. The modules which miss either the new or the base list
+// are listed in the returned error, the reports of the complete pairs are always returned.
+func GenModuleDiffReports(newLists map[string]CoverageList, baseLists map[string]CoverageList, opts *DiffReportOptions) (map[string][][]string, error) {
+	reports := make(map[string][][]string)
+	var missing []string
+	for module, n := range newLists {
+		b, ok := baseLists[module]
+		if !ok {
+			missing = append(missing, fmt.Sprintf("%s (no base profile)", module))
+			continue
+		}
+		reports[module] = GenLocalCoverDiffReport(n, b, opts)
+	}
+	for module := range baseLists {
+		if _, ok := newLists[module]; !ok {
+			missing = append(missing, fmt.Sprintf("%s (no new profile)", module))
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return reports, fmt.Errorf("incomplete profile pairs: [%s]", strings.Join(missing, ", "))
+	}
+	return reports, nil
+}
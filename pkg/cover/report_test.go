@@ -0,0 +1,312 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenLocalCoverDiffReport(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: "b", NCoveredStmts: 10, NAllStmts: 20},
+		Coverage{FileName: "c", NCoveredStmts: 19, NAllStmts: 20},
+		Coverage{FileName: "d", NCoveredStmts: 10, NAllStmts: 20},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 10, NAllStmts: 20},
+		Coverage{FileName: "b", NCoveredStmts: 18, NAllStmts: 20},
+		Coverage{FileName: "c", NCoveredStmts: 18, NAllStmts: 20},
+		Coverage{FileName: "d", NCoveredStmts: 10, NAllStmts: 20},
+	}
+
+	items := []struct {
+		opts         *DiffReportOptions
+		expectHeader []string
+		expectRows   [][]string
+	}{
+		{
+			opts:         nil,
+			expectHeader: []string{"File", "Base Coverage", "New Coverage", "Delta"},
+			expectRows: [][]string{
+				{"a", "50.0%", "75.0%", "25.0%"},
+				{"b", "90.0%", "50.0%", "-40.0%"},
+				{"c", "90.0%", "95.0%", "5.0%"},
+				{"Total", "70.0%", "67.5%", "-2.5%"},
+			},
+		},
+		{
+			opts:         &DiffReportOptions{FlagCrossings: true, CrossThreshold: 0.7},
+			expectHeader: []string{"File", "Base Coverage", "New Coverage", "Delta", "Threshold"},
+			expectRows: [][]string{
+				{"a", "50.0%", "75.0%", "25.0%", CrossedAbove},
+				{"b", "90.0%", "50.0%", "-40.0%", CrossedBelow},
+				{"c", "90.0%", "95.0%", "5.0%", ""},
+				{"Total", "70.0%", "67.5%", "-2.5%", CrossedBelow},
+			},
+		},
+	}
+
+	for _, tc := range items {
+		assert.Equal(t, tc.expectHeader, DiffReportHeader(tc.opts))
+		assert.Equal(t, tc.expectRows, GenLocalCoverDiffReport(newList, baseList, tc.opts))
+	}
+}
+
+func TestGenLocalCoverDiffReportPrecision(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 1000, NAllStmts: 3000},
+		Coverage{FileName: "c", NCoveredStmts: 1, NAllStmts: 3},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 1001, NAllStmts: 3000},
+		Coverage{FileName: "b", NCoveredStmts: 0, NAllStmts: 0},
+	}
+
+	precision := func(p int) *int { return &p }
+	items := []struct {
+		opts       *DiffReportOptions
+		expectRows [][]string
+	}{
+		{
+			opts: nil,
+			expectRows: [][]string{
+				{"c", "None", "33.3%", "33.3%"},
+				{"Total", "33.4%", "33.3%", "0.0%"},
+			},
+		},
+		{
+			opts: &DiffReportOptions{DeltaPrecision: precision(2)},
+			expectRows: [][]string{
+				{"a", "33.4%", "33.3%", "-0.03%"},
+				{"c", "None", "33.3%", "33.33%"},
+				{"Total", "33.4%", "33.3%", "-0.03%"},
+			},
+		},
+		{
+			opts: &DiffReportOptions{ValuePrecision: precision(2), DeltaPrecision: precision(3)},
+			expectRows: [][]string{
+				{"a", "33.37%", "33.33%", "-0.033%"},
+				{"c", "None", "33.33%", "33.333%"},
+				{"Total", "33.37%", "33.33%", "-0.033%"},
+			},
+		},
+		{
+			opts: &DiffReportOptions{ValuePrecision: precision(0), DeltaPrecision: precision(0)},
+			expectRows: [][]string{
+				{"c", "None", "33%", "33%"},
+				{"Total", "33%", "33%", "0%"},
+			},
+		},
+	}
+
+	for _, tc := range items {
+		assert.Equal(t, tc.expectRows, GenLocalCoverDiffReport(newList, baseList, tc.opts))
+	}
+
+	// a -0.4% and a +0.4% delta both round to 0 at precision 0
+	newList = CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 496, NAllStmts: 1000},
+		Coverage{FileName: "b", NCoveredStmts: 504, NAllStmts: 1000},
+	}
+	baseList = CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 500, NAllStmts: 1000},
+		Coverage{FileName: "b", NCoveredStmts: 500, NAllStmts: 1000},
+	}
+	assert.Equal(t, [][]string{
+		{"Total", "50%", "50%", "0%"},
+	}, GenLocalCoverDiffReport(newList, baseList, &DiffReportOptions{ValuePrecision: precision(0), DeltaPrecision: precision(0)}))
+}
+
+func TestGenLocalCoverDiffReportColumns(t *testing.T) {
+	newList := CoverageList{Coverage{FileName: "a", NCoveredStmts: 15, NAllStmts: 20}}
+	baseList := CoverageList{Coverage{FileName: "a", NCoveredStmts: 10, NAllStmts: 20}}
+	opts := &DiffReportOptions{Columns: []DiffColumn{ColumnDelta, ColumnNew, ColumnBase, ColumnFile}}
+
+	assert.Equal(t, []string{"Delta", "New Coverage", "Base Coverage", "File"}, DiffReportHeader(opts))
+	assert.Equal(t, [][]string{
+		{"25.0%", "75.0%", "50.0%", "a"},
+		{"25.0%", "75.0%", "50.0%", "Total"},
+	}, GenLocalCoverDiffReport(newList, baseList, opts))
+}
+
+func TestGenModuleDiffReports(t *testing.T) {
+	newLists := map[string]CoverageList{
+		"a": {Coverage{FileName: "a", NCoveredStmts: 15, NAllStmts: 20}},
+		"b": {Coverage{FileName: "b", NCoveredStmts: 15, NAllStmts: 20}},
+	}
+	baseLists := map[string]CoverageList{
+		"a": {Coverage{FileName: "a", NCoveredStmts: 10, NAllStmts: 20}},
+		"c": {Coverage{FileName: "c", NCoveredStmts: 10, NAllStmts: 20}},
+	}
+
+	reports, err := GenModuleDiffReports(newLists, baseLists, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "b (no base profile)")
+	assert.Contains(t, err.Error(), "c (no new profile)")
+	assert.Equal(t, map[string][][]string{
+		"a": {{"a", "50.0%", "75.0%", "25.0%"}, {"Total", "50.0%", "75.0%", "25.0%"}},
+	}, reports)
+
+	delete(newLists, "b")
+	delete(baseLists, "c")
+	_, err = GenModuleDiffReports(newLists, baseLists, nil)
+	assert.NoError(t, err)
+}
+
+func TestGenLocalCoverDiffReportStmts(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 1, NAllStmts: 2},
+		Coverage{FileName: "b", NCoveredStmts: 3, NAllStmts: 4},
+	}
+	baseList := CoverageList{Coverage{FileName: "a", NCoveredStmts: 2, NAllStmts: 2}}
+	opts := &DiffReportOptions{ShowStmts: true}
+
+	assert.Equal(t, []string{"File", "Base Coverage", "New Coverage", "Delta", "Base Statements", "New Statements"}, DiffReportHeader(opts))
+	assert.Equal(t, [][]string{
+		{"a", "100.0%", "50.0%", "-50.0%", "2/2", "1/2"},
+		{"b", "None", "75.0%", "75.0%", "None", "3/4"},
+		{"Total", "100.0%", "66.7%", "-33.3%", "2/2", "4/6"},
+	}, GenLocalCoverDiffReport(newList, baseList, opts))
+}
+
+func TestGenLocalCoverDiffReportBasisPoints(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 1, NAllStmts: 2},
+		Coverage{FileName: "b", NCoveredStmts: 9995, NAllStmts: 10000},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 2, NAllStmts: 2},
+		Coverage{FileName: "b", NCoveredStmts: 9993, NAllStmts: 10000},
+	}
+	opts := &DiffReportOptions{BasisPoints: true}
+
+	assert.Equal(t, []string{"File", "Base Coverage", "New Coverage", "Delta", "Delta (bp)"}, DiffReportHeader(opts))
+	assert.Equal(t, [][]string{
+		{"a", "100.0%", "50.0%", "-50.0%", "-5000"},
+		// below the delta precision, kept for its basis points
+		{"b", "99.9%", "99.9%", "0.0%", "+2"},
+		{"Total", "99.9%", "99.9%", "0.0%", "+1"},
+	}, GenLocalCoverDiffReport(newList, baseList, opts))
+	// omitted without the basis points
+	assert.Equal(t, 2, len(GenLocalCoverDiffReport(newList, baseList, nil)))
+}
+
+func TestGenLocalCoverDiffReportRenames(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "new.go", NCoveredStmts: 1, NAllStmts: 2},
+		Coverage{FileName: "b.go", NCoveredStmts: 3, NAllStmts: 4},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "old.go", NCoveredStmts: 2, NAllStmts: 2},
+		Coverage{FileName: "b.go", NCoveredStmts: 1, NAllStmts: 4},
+	}
+	opts := &DiffReportOptions{Renames: map[string]string{"new.go": "old.go"}}
+
+	assert.Equal(t, [][]string{
+		{"b.go", "25.0%", "75.0%", "50.0%"},
+		{"new.go", "100.0%", "50.0%", "-50.0%"},
+		{"Total", "50.0%", "66.7%", "16.7%"},
+	}, GenLocalCoverDiffReport(newList, baseList, opts))
+	// the base list is left untouched
+	assert.Equal(t, "old.go", baseList[0].FileName)
+
+	assert.Equal(t, [][]string{
+		{"b.go", "25.0%", "75.0%", "50.0%"},
+		{"new.go", "None", "50.0%", "50.0%"},
+		{"old.go", "100.0%", "None", "-100.0%"},
+		{"Total", "50.0%", "66.7%", "16.7%"},
+	}, GenLocalCoverDiffReport(newList, baseList, nil))
+}
+
+func TestGenRatioDiffReport(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 1, NAllStmts: 2},
+		Coverage{FileName: "b", NCoveredStmts: 3, NAllStmts: 4},
+		Coverage{FileName: "c", NCoveredStmts: 7, NAllStmts: 10},
+	}
+	baseRatios := map[string]float32{"a": 0.8, "c": 0.7, "removed": 0.5, TotalRatioKey: 0.6}
+
+	assert.Equal(t, [][]string{
+		{"a", "80.0%", "50.0%", "-30.0%"},
+		{"b", "None", "75.0%", "75.0%"},
+		{"removed", "50.0%", "None", "-50.0%"},
+		{"Total", "60.0%", "68.8%", "8.7%"},
+	}, GenRatioDiffReport(newList, baseRatios, nil))
+
+	opts := &DiffReportOptions{ShowStmts: true, BasisPoints: true, Intersection: true}
+	assert.Equal(t, [][]string{
+		{"a", "80.0%", "50.0%", "-30.0%", "-3000", "None", "1/2"},
+		{"Total", "60.0%", "66.7%", "6.7%", "+666", "None", "8/12"},
+	}, GenRatioDiffReport(newList, baseRatios, opts))
+
+	delete(baseRatios, TotalRatioKey)
+	opts = &DiffReportOptions{Renames: map[string]string{"b": "removed"}}
+	assert.Equal(t, [][]string{
+		{"a", "80.0%", "50.0%", "-30.0%"},
+		{"b", "50.0%", "75.0%", "25.0%"},
+		{"Total", "None", "68.8%", "68.8%"},
+	}, GenRatioDiffReport(newList, baseRatios, opts))
+}
+
+func TestRatioMap(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 1, NAllStmts: 2},
+		Coverage{FileName: "b", NCoveredStmts: 0, NAllStmts: 0},
+		Coverage{FileName: "c", NCoveredStmts: 2, NAllStmts: 2},
+	}
+	assert.Equal(t, map[string]float32{"a": 0.5, "c": 1, TotalRatioKey: 0.75}, list.RatioMap())
+	assert.Equal(t, [][]string{{"Total", "75.0%", "75.0%", "0.0%"}}, GenRatioDiffReport(list, list.RatioMap(), nil))
+}
+
+func TestGenLocalCoverDiffReportMinStmts(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 0, NAllStmts: 2},
+		Coverage{FileName: "b", NCoveredStmts: 3, NAllStmts: 10},
+		Coverage{FileName: "c", NCoveredStmts: 1, NAllStmts: 1},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 2, NAllStmts: 2},
+		Coverage{FileName: "b", NCoveredStmts: 5, NAllStmts: 10},
+		Coverage{FileName: "c", NCoveredStmts: 0, NAllStmts: 8},
+	}
+	opts := &DiffReportOptions{MinStmts: 5}
+
+	assert.Equal(t, [][]string{
+		{"b", "50.0%", "30.0%", "-20.0%"},
+		{"c", "0.0%", "100.0%", "100.0%"},
+		{"Total", "35.0%", "30.8%", "-4.2%"},
+	}, GenLocalCoverDiffReport(newList, baseList, opts))
+}
+
+func TestGenLocalCoverDiffReportIntersection(t *testing.T) {
+	newList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 1, NAllStmts: 2},
+		Coverage{FileName: "b", NCoveredStmts: 3, NAllStmts: 4},
+	}
+	baseList := CoverageList{
+		Coverage{FileName: "a", NCoveredStmts: 2, NAllStmts: 2},
+		Coverage{FileName: "c", NCoveredStmts: 0, NAllStmts: 4},
+	}
+
+	assert.Equal(t, [][]string{
+		{"a", "100.0%", "50.0%", "-50.0%"},
+		{"Total", "100.0%", "50.0%", "-50.0%"},
+	}, GenLocalCoverDiffReport(newList, baseList, &DiffReportOptions{Intersection: true}))
+}
@@ -30,7 +30,6 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	log "github.com/sirupsen/logrus"
 	"golang.org/x/tools/cover"
 	"k8s.io/test-infra/gopherage/pkg/cov"
 )
@@ -63,17 +62,18 @@ func NewMemoryBasedServer() *server {
 	}
 }
 
-// Run starts coverage host center
-func (s *server) Run(port string) {
+// Run starts coverage host center, it blocks until the server fails
+func (s *server) Run(port string) error {
 	f, err := os.Create(LogFile)
 	if err != nil {
-		log.Fatalf("failed to create log file %s, err: %v", LogFile, err)
+		return fmt.Errorf("failed to create log file %s, err: %v", LogFile, err)
 	}
+	defer f.Close()
 
 	// both log to stdout and file by default
 	mw := io.MultiWriter(f, os.Stdout)
 	r := s.Route(mw)
-	log.Fatal(r.Run(port))
+	return r.Run(port)
 }
 
 // Router init goc server engine
@@ -169,7 +169,7 @@ func (s *server) registerService(c *gin.Context) {
 		// only for IPV4
 		// refer: https://github.com/qiniu/goc/issues/177
 		if net.ParseIP(realIP).To4() != nil && host != realIP {
-			log.Printf("the registered host %s of service %s is different with the real one %s, here we choose the real one", service.Name, host, realIP)
+			logger.Printf("the registered host %s of service %s is different with the real one %s, here we choose the real one", service.Name, host, realIP)
 			host = realIP
 		}
 	}
@@ -209,10 +209,14 @@ func (s *server) profile(c *gin.Context) {
 
 	var mergedProfiles = make([][]*cover.Profile, 0)
 	for _, addrInfo := range filterAddrInfoList {
-		pp, err := NewWorker(addrInfo.Address).Profile(ProfileParam{})
+		var pp []byte
+		worker, err := NewWorker(addrInfo.Address)
+		if err == nil {
+			pp, err = worker.Profile(ProfileParam{})
+		}
 		if err != nil {
 			if body.Force {
-				log.Warnf("get profile from [%s] failed, error: %s", addrInfo, err.Error())
+				logger.Warnf("get profile from [%s] failed, error: %s", addrInfo, err.Error())
 				continue
 			}
 
@@ -318,7 +322,11 @@ func (s *server) clear(c *gin.Context) {
 		return
 	}
 	for _, addrInfo := range filterAddrInfoList {
-		pp, err := NewWorker(addrInfo.Address).Clear(ProfileParam{})
+		var pp []byte
+		worker, err := NewWorker(addrInfo.Address)
+		if err == nil {
+			pp, err = worker.Clear(ProfileParam{})
+		}
 		if err != nil {
 			c.JSON(http.StatusExpectationFailed, gin.H{"error": err.Error()})
 			return
@@ -407,7 +415,7 @@ func filterAddrInfo(serviceList, addressList []string, force bool, allInfos map[
 		if !force {
 			return nil, fmt.Errorf("service [%s] not found", name)
 		}
-		log.Warnf("service [%s] not found", name)
+		logger.Warnf("service [%s] not found", name)
 	}
 
 	// Add matched addresses to map
@@ -419,7 +427,7 @@ func filterAddrInfo(serviceList, addressList []string, force bool, allInfos map[
 		if !force {
 			return nil, fmt.Errorf("address [%s] not found", addr)
 		}
-		log.Warnf("address [%s] not found", addr)
+		logger.Warnf("address [%s] not found", addr)
 	}
 
 	if len(addressList) == 0 && len(serviceList) == 0 {
@@ -0,0 +1,123 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"unicode/utf8"
+)
+
+const (
+	// slackFileNameLimit is the max length of a file name in a Slack message, longer names
+	// keep their tail so that the file itself can still be told
+	slackFileNameLimit = 60
+	// slackSectionTextLimit is the max length of the text of a Slack section block
+	slackSectionTextLimit = 3000
+)
+
+// slackBlock is a block of the Slack Block Kit, see https://api.slack.com/block-kit
+type slackBlock struct {
+	Type     string       `json:"type"`
+	Text     *slackText   `json:"text,omitempty"`
+	Elements []*slackText `json:"elements,omitempty"`
+}
+
+type slackText struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Emoji bool   `json:"emoji,omitempty"`
+}
+
+// WriteSlackBlocks writes a Slack Block Kit message, i.e. {"blocks": [...]}, summarizing the
+// total coverage of newList, its delta against baseList and the topN files which dropped
+// most with emoji indicators, so that a bot can post it as is. The regressions which do
+// not fit topN or the text limit of a section are counted in a context block. An empty
+// baseList reports the coverage as new without regressions. topN must be at least 1.
+func WriteSlackBlocks(w io.Writer, newList, baseList CoverageList, topN int) error {
+	if topN < 1 {
+		return fmt.Errorf("the number of top regressions %d is less than 1", topN)
+	}
+	overall := fmt.Sprintf("*Overall coverage:* %s", newList.TotalPercentage())
+	if len(baseList) == 0 {
+		overall += " (new)"
+	} else {
+		delta := deltaPercent(TotalDelta(newList, baseList))
+		overall += fmt.Sprintf(" %s %+.1f%%", slackIndicator(delta), delta)
+	}
+	blocks := []slackBlock{
+		{Type: "header", Text: &slackText{Type: "plain_text", Text: "Coverage report", Emoji: true}},
+		{Type: "section", Text: &slackText{Type: "mrkdwn", Text: overall}},
+	}
+
+	if len(baseList) > 0 {
+		regressions := newList.Regressions(baseList, 0, false)
+		sort.SliceStable(regressions, func(i, j int) bool {
+			return *regressions[i].BaseRatio-regressions[i].NewRatio > *regressions[j].BaseRatio-regressions[j].NewRatio
+		})
+		text := ":white_check_mark: No file regressed"
+		shown := 0
+		if len(regressions) > 0 {
+			text = "*Top regressions:*"
+			top := regressions
+			if len(top) > topN {
+				top = top[:topN]
+			}
+			for _, r := range top {
+				line := fmt.Sprintf("\n%s `%s` %s → %s (%+.1f%%)", slackIndicator(-1),
+					slackFileName(r.File), PercentStr(*r.BaseRatio), PercentStr(r.NewRatio), deltaPercent(r.NewRatio-*r.BaseRatio))
+				if utf8.RuneCountInString(text)+utf8.RuneCountInString(line) > slackSectionTextLimit {
+					break
+				}
+				text += line
+				shown++
+			}
+		}
+		blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: text}})
+		if more := len(regressions) - shown; more > 0 {
+			blocks = append(blocks, slackBlock{Type: "context", Elements: []*slackText{
+				{Type: "mrkdwn", Text: fmt.Sprintf("and %d more regressed files", more)},
+			}})
+		}
+	}
+
+	return json.NewEncoder(w).Encode(struct {
+		Blocks []slackBlock `json:"blocks"`
+	}{blocks})
+}
+
+// slackIndicator returns the emoji of the direction of the delta
+func slackIndicator(delta float64) string {
+	switch {
+	case delta > 0:
+		return ":large_green_circle:"
+	case delta < 0:
+		return ":red_circle:"
+	}
+	return ":white_circle:"
+}
+
+// slackFileName cuts the name to slackFileNameLimit, keeping its tail after an ellipsis
+func slackFileName(name string) string {
+	if utf8.RuneCountInString(name) <= slackFileNameLimit {
+		return name
+	}
+	runes := []rune(name)
+	return "…" + string(runes[len(runes)-slackFileNameLimit+1:])
+}
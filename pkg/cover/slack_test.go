@@ -0,0 +1,120 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteSlackBlocks(t *testing.T) {
+	long := strings.Repeat("d", 70) + ".go"
+	base := CoverageList{
+		{FileName: "a.go", NCoveredStmts: 9, NAllStmts: 10},
+		{FileName: "b.go", NCoveredStmts: 8, NAllStmts: 10},
+		{FileName: "c.go", NCoveredStmts: 5, NAllStmts: 10},
+		{FileName: long, NCoveredStmts: 10, NAllStmts: 10},
+	}
+	newList := CoverageList{
+		{FileName: "a.go", NCoveredStmts: 8, NAllStmts: 10},
+		{FileName: "b.go", NCoveredStmts: 4, NAllStmts: 10},
+		{FileName: "c.go", NCoveredStmts: 6, NAllStmts: 10},
+		{FileName: long, NCoveredStmts: 7, NAllStmts: 10},
+	}
+
+	type message struct {
+		Blocks []struct {
+			Type     string
+			Text     struct{ Text string }
+			Elements []struct{ Text string }
+		}
+	}
+	items := []struct {
+		base   CoverageList
+		topN   int
+		expect []string
+	}{
+		{
+			base: base, topN: 2,
+			expect: []string{
+				"Coverage report",
+				"*Overall coverage:* 62.5% :red_circle: -17.5%",
+				"*Top regressions:*\n:red_circle: `b.go` 80.0% → 40.0% (-40.0%)\n" +
+					":red_circle: `…" + long[len(long)-slackFileNameLimit+1:] + "` 100.0% → 70.0% (-30.0%)",
+				"and 1 more regressed files",
+			},
+		},
+		{
+			base: newList, topN: 2,
+			expect: []string{"Coverage report", "*Overall coverage:* 62.5% :white_circle: +0.0%", ":white_check_mark: No file regressed"},
+		},
+		{
+			base: nil, topN: 2,
+			expect: []string{"Coverage report", "*Overall coverage:* 62.5% (new)"},
+		},
+	}
+	for _, tc := range items {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteSlackBlocks(&buf, newList, tc.base, tc.topN))
+		var msg message
+		assert.NoError(t, json.Unmarshal(buf.Bytes(), &msg))
+		var texts []string
+		for _, b := range msg.Blocks {
+			if b.Type == "context" {
+				texts = append(texts, b.Elements[0].Text)
+			} else {
+				texts = append(texts, b.Text.Text)
+			}
+		}
+		assert.Equal(t, tc.expect, texts)
+	}
+}
+
+func TestWriteSlackBlocksLimits(t *testing.T) {
+	var base, newList CoverageList
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("%s/%03d.go", strings.Repeat("p", 60), i)
+		base = append(base, Coverage{FileName: name, NCoveredStmts: 10, NAllStmts: 10})
+		newList = append(newList, Coverage{FileName: name, NCoveredStmts: 5, NAllStmts: 10})
+	}
+
+	var buf bytes.Buffer
+	assert.Error(t, WriteSlackBlocks(&buf, newList, base, 0))
+
+	assert.NoError(t, WriteSlackBlocks(&buf, newList, base, 100))
+	var msg struct {
+		Blocks []struct {
+			Type     string
+			Text     struct{ Text string }
+			Elements []struct{ Text string }
+		}
+	}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &msg))
+	if assert.Equal(t, 4, len(msg.Blocks)) {
+		text := msg.Blocks[2].Text.Text
+		assert.True(t, utf8.RuneCountInString(text) <= slackSectionTextLimit)
+		shown := strings.Count(text, "\n")
+		assert.True(t, shown > 0 && shown < 100)
+		assert.Equal(t, fmt.Sprintf("and %d more regressed files", 100-shown), msg.Blocks[3].Elements[0].Text)
+	}
+}
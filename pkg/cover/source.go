@@ -0,0 +1,606 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/mod/modfile"
+)
+
+// funcExtent describes a function declaration in a source file
+type funcExtent struct {
+	name       string
+	startLine  int
+	startCol   int
+	endLine    int
+	endCol     int
+	deprecated bool // the function or its receiver type has a Deprecated doc comment
+}
+
+// sourcePath finds the file on disk for a profile file name under srcRoot.
+// The profile file name is an import path, which is looked up relative to srcRoot by
+// sourceRelPaths.
+func sourcePath(srcRoot string, fileName string) (string, bool) {
+	if filepath.IsAbs(fileName) && isFileExist(fileName) {
+		return fileName, true
+	}
+	for _, rel := range sourceRelPaths(modulePathOf(srcRoot), fileName) {
+		if p := filepath.Join(srcRoot, filepath.FromSlash(rel)); isFileExist(p) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// sourceRelPaths returns the candidate paths, relative to the source root in slash form,
+// of the import path of a profile file. With modPath, the module path of the go.mod at the
+// root, it is only the path relative to the module, none for a file of another module.
+// Without it, the leading elements are stripped one by one, e.g. of a GOPATH or module
+// path, but a directory is kept so that a file never matches a same-named one elsewhere.
+func sourceRelPaths(modPath string, fileName string) []string {
+	name := filepath.ToSlash(fileName)
+	if modPath != "" {
+		if strings.HasPrefix(name, modPath+"/") {
+			return []string{strings.TrimPrefix(name, modPath+"/")}
+		}
+		return nil
+	}
+	var rels []string
+	for {
+		rels = append(rels, name)
+		i := strings.Index(name, "/")
+		if i < 0 || !strings.Contains(name[i+1:], "/") {
+			return rels
+		}
+		name = name[i+1:]
+	}
+}
+
+func isFileExist(path string) bool {
+	s, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return !s.IsDir()
+}
+
+// findFuncs parses the go source file and returns the extents of its function declarations
+func findFuncs(name string) ([]funcExtent, error) {
+	fset := token.NewFileSet()
+	parsedFile, err := parser.ParseFile(fset, name, nil, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	deprecatedTypes := make(map[string]bool)
+	for _, decl := range parsedFile.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if isDeprecated(ts.Doc) || (len(gen.Specs) == 1 && isDeprecated(gen.Doc)) {
+				deprecatedTypes[ts.Name.Name] = true
+			}
+		}
+	}
+
+	var funcs []funcExtent
+	for _, decl := range parsedFile.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok {
+			continue
+		}
+		start := fset.Position(fn.Pos())
+		end := fset.Position(fn.End())
+		funcs = append(funcs, funcExtent{
+			name:       fn.Name.Name,
+			startLine:  start.Line,
+			startCol:   start.Column,
+			endLine:    end.Line,
+			endCol:     end.Column,
+			deprecated: isDeprecated(fn.Doc) || (fn.Recv != nil && deprecatedTypes[recvTypeName(fn.Recv)]),
+		})
+	}
+	return funcs, nil
+}
+
+// isDeprecated reports whether the doc comment has a paragraph starting with "Deprecated:",
+// the convention of go doc
+func isDeprecated(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, paragraph := range strings.Split(doc.Text(), "\n\n") {
+		if strings.HasPrefix(paragraph, "Deprecated:") {
+			return true
+		}
+	}
+	return false
+}
+
+// recvTypeName returns the name of the base type of a method receiver
+func recvTypeName(recv *ast.FieldList) string {
+	if len(recv.List) == 0 {
+		return ""
+	}
+	expr := recv.List[0].Type
+	for {
+		switch t := expr.(type) {
+		case *ast.StarExpr:
+			expr = t.X
+		case *ast.IndexExpr:
+			expr = t.X
+		case *ast.IndexListExpr:
+			expr = t.X
+		case *ast.Ident:
+			return t.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// contains reports whether the start of the block lies in the function
+func (f *funcExtent) contains(b *CoverBlock) bool {
+	if b.StartLine < f.startLine || (b.StartLine == f.startLine && b.StartCol < f.startCol) {
+		return false
+	}
+	if b.StartLine > f.endLine || (b.StartLine == f.endLine && b.StartCol > f.endCol) {
+		return false
+	}
+	return true
+}
+
+// FuncCache finds the enclosing functions of blocks by parsing the source files under
+// its root, each file is parsed once however many blocks and profiles refer to it.
+// It is safe for concurrent use.
+type FuncCache struct {
+	srcRoot string
+	mu      sync.Mutex
+	files   map[string]*funcFile
+}
+
+// funcFile holds the function declarations of a source file, found is false if the
+// file does not exist under the root
+type funcFile struct {
+	funcs []funcExtent
+	found bool
+	err   error
+}
+
+// NewFuncCache creates a FuncCache of the source files under srcRoot
+func NewFuncCache(srcRoot string) *FuncCache {
+	return &FuncCache{srcRoot: srcRoot, files: make(map[string]*funcFile)}
+}
+
+// funcsOf returns the function declarations of the source file of a profile file name
+func (c *FuncCache) funcsOf(fileName string) ([]funcExtent, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.files[fileName]
+	if !ok {
+		f = &funcFile{}
+		var p string
+		if p, f.found = sourcePath(c.srcRoot, fileName); f.found {
+			if f.funcs, f.err = findFuncs(p); f.err != nil {
+				f.err = fmt.Errorf("parse source file %s failed: %v", p, f.err)
+			}
+		}
+		c.files[fileName] = f
+	}
+	return f.funcs, f.found, f.err
+}
+
+// AttachFuncNames sets the FuncName of every retained block by parsing the source files under srcRoot.
+// Files which cannot be found are reported in the returned error, their blocks are left untouched.
+func (g CoverageList) AttachFuncNames(srcRoot string) error {
+	cache := NewFuncCache(srcRoot)
+	var missing []string
+	for i := range g {
+		funcs, ok, err := cache.funcsOf(g[i].FileName)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			missing = append(missing, g[i].FileName)
+			continue
+		}
+		attachFuncNames(g[i].Blocks, funcs)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("source files not found under %s: [%s]", srcRoot, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func attachFuncNames(blocks []CoverBlock, funcs []funcExtent) {
+	for j := range blocks {
+		blocks[j].FuncName = funcNameOf(&blocks[j], funcs)
+	}
+}
+
+// funcNameOf returns the name of the function enclosing the block, empty if none
+func funcNameOf(b *CoverBlock, funcs []funcExtent) string {
+	for k := range funcs {
+		if funcs[k].contains(b) {
+			return funcs[k].name
+		}
+	}
+	return ""
+}
+
+// ExportedCoverage returns the coverage restricted to blocks within exported functions.
+// It relies on the FuncName of the blocks, see AttachFuncNames. Files without any
+// statement in exported functions are omitted.
+func (g CoverageList) ExportedCoverage() CoverageList {
+	return g.filterBlocks(func(b *CoverBlock) bool {
+		return isExported(b.FuncName)
+	})
+}
+
+// ExcludeFuncs returns the coverage without the blocks in functions whose name matches
+// one of the patterns, the patterns are in the syntax of path.Match, e.g. "String" or "must*".
+// It relies on the FuncName of the blocks, see AttachFuncNames. Files left without any
+// statement are omitted.
+func (g CoverageList) ExcludeFuncs(names []string) (CoverageList, error) {
+	for _, name := range names {
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("bad function name pattern %s: %v", name, err)
+		}
+	}
+	return g.filterBlocks(func(b *CoverBlock) bool {
+		if b.FuncName == "" {
+			return true
+		}
+		for _, name := range names {
+			if ok, _ := path.Match(name, b.FuncName); ok {
+				return false
+			}
+		}
+		return true
+	}), nil
+}
+
+// ExcludeDeprecated returns the coverage without the blocks in the functions whose doc
+// comment, or the one of their receiver type, has a "Deprecated:" paragraph, so that the
+// deprecated but still present code is not gated. The source files are parsed under
+// srcRoot. Files left without any statement are omitted. The files which can not be
+// found are kept as is and listed in the returned error, the result is always returned.
+func (g CoverageList) ExcludeDeprecated(srcRoot string) (CoverageList, error) {
+	cache := NewFuncCache(srcRoot)
+	var missing []string
+	for _, c := range g {
+		_, ok, err := cache.funcsOf(c.FileName)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			missing = append(missing, c.FileName)
+		}
+	}
+
+	res := g.filterBlocks(func(b *CoverBlock) bool {
+		funcs, _, _ := cache.funcsOf(b.FileName)
+		for k := range funcs {
+			if funcs[k].contains(b) {
+				return !funcs[k].deprecated
+			}
+		}
+		return true
+	})
+	if len(missing) > 0 {
+		return res, fmt.Errorf("source files not found under %s: [%s]", srcRoot, strings.Join(missing, ", "))
+	}
+	return res, nil
+}
+
+// ExcludeLines returns the coverage without the blocks whose source consists only of lines
+// matching one of the patterns, e.g. `^log\.Debug` drops the blocks doing nothing but debug
+// logging from the denominators. Each line of a block is matched within the columns of the
+// block with the surrounding spaces and braces trimmed, and the blank lines are ignored.
+// Files left without any statement are omitted. The files which can not be found under
+// srcRoot are kept as is and listed in the returned error, the result is always returned.
+func (g CoverageList) ExcludeLines(srcRoot string, patterns []string) (CoverageList, error) {
+	var regexps []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("bad line pattern %s: %v", p, err)
+		}
+		regexps = append(regexps, re)
+	}
+
+	sources := make(map[string][]string)
+	var missing []string
+	for _, c := range g {
+		if _, ok := sources[c.FileName]; ok {
+			continue
+		}
+		p, ok := sourcePath(srcRoot, c.FileName)
+		if !ok {
+			missing = append(missing, c.FileName)
+			sources[c.FileName] = nil
+			continue
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		sources[c.FileName] = strings.Split(string(content), "\n")
+	}
+
+	res := g.filterBlocks(func(b *CoverBlock) bool {
+		lines := sources[b.FileName]
+		if lines == nil {
+			return true
+		}
+		matched := false
+		for _, text := range blockLines(lines, b) {
+			text = strings.TrimSpace(strings.Trim(strings.TrimSpace(text), "{}"))
+			if text == "" {
+				continue
+			}
+			if !matchAny(regexps, text) {
+				return true
+			}
+			matched = true
+		}
+		return !matched
+	})
+	if len(missing) > 0 {
+		return res, fmt.Errorf("source files not found under %s: [%s]", srcRoot, strings.Join(missing, ", "))
+	}
+	return res, nil
+}
+
+// ExcludeUnbuiltFiles returns the list without the files which are not part of the tested
+// build with the active tags, e.g. so that the files of other platforms do not count against
+// it: the files whose GOOS and GOARCH file name suffixes, like foo_windows.go, or build
+// constraints, the //go:build or legacy // +build lines of their source under srcRoot, are
+// not satisfied by the tags. The tags must include the GOOS and GOARCH of the build.
+// The files not found are kept and listed in the returned error.
+func (g CoverageList) ExcludeUnbuiltFiles(srcRoot string, tags []string) (CoverageList, error) {
+	// only the tags are active, GOOS and GOARCH match through them
+	ctxt := build.Context{BuildTags: tags}
+	res := NewCoverageList()
+	var missing []string
+	for _, c := range g {
+		p, ok := sourcePath(srcRoot, c.FileName)
+		if !ok {
+			missing = append(missing, c.FileName)
+			res = append(res, c)
+			continue
+		}
+		match, err := ctxt.MatchFile(filepath.Dir(p), filepath.Base(p))
+		if err != nil {
+			return nil, fmt.Errorf("match build constraints of %s failed: %v", p, err)
+		}
+		if match {
+			res = append(res, c)
+		}
+	}
+	if len(missing) > 0 {
+		return res, fmt.Errorf("source files not found under %s: [%s]", srcRoot, strings.Join(missing, ", "))
+	}
+	return res, nil
+}
+
+// blockLines returns the source of the block line by line, cut at its columns
+func blockLines(lines []string, b *CoverBlock) []string {
+	var res []string
+	for l := b.StartLine; l <= b.EndLine && l <= len(lines); l++ {
+		text := lines[l-1]
+		if l == b.EndLine && b.EndCol-1 < len(text) && b.EndCol > 0 {
+			text = text[:b.EndCol-1]
+		}
+		if l == b.StartLine && b.StartCol > 0 {
+			if b.StartCol-1 < len(text) {
+				text = text[b.StartCol-1:]
+			} else {
+				text = ""
+			}
+		}
+		res = append(res, text)
+	}
+	return res
+}
+
+func matchAny(regexps []*regexp.Regexp, s string) bool {
+	for _, re := range regexps {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterBlocks recomputes the coverage of every file with the retained blocks which keep returns true for
+func (g CoverageList) filterBlocks(keep func(b *CoverBlock) bool) CoverageList {
+	res := NewCoverageList()
+	for _, c := range g {
+		filtered := Coverage{FileName: c.FileName, LineCovLink: c.LineCovLink, Mode: c.Mode}
+		for i := range c.Blocks {
+			b := &c.Blocks[i]
+			if !keep(b) {
+				continue
+			}
+			filtered.Blocks = append(filtered.Blocks, *b)
+			filtered.NAllStmts += b.NumStmt
+			if b.Count > 0 {
+				filtered.NCoveredStmts += b.NumStmt
+			}
+		}
+		if filtered.NAllStmts > 0 {
+			res = append(res, filtered)
+		}
+	}
+	return res
+}
+
+func isExported(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+// DetectStale returns the files whose blocks reference lines past the end of their source
+// under srcRoot, which means the profile was generated from an older version of the source.
+// Files which cannot be found under srcRoot are not reported.
+func (g CoverageList) DetectStale(srcRoot string) []string {
+	var stale []string
+	for _, c := range g {
+		p, ok := sourcePath(srcRoot, c.FileName)
+		if !ok {
+			continue
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		lines := bytes.Count(content, []byte("\n"))
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			lines++
+		}
+		for _, b := range c.Blocks {
+			if b.EndLine > lines {
+				stale = append(stale, c.FileName)
+				break
+			}
+		}
+	}
+	return stale
+}
+
+// MissingFiles returns the .go files under srcRoot, relative to it in slash form, which
+// have no entry in the list at all, i.e. they were never instrumented or compiled and
+// escape any gating. The profile file names are matched by their paths relative to
+// srcRoot, see sourceRelPaths, so that with a go.mod at srcRoot the match is exact.
+// The directories the go tool ignores, vendor and testdata are skipped, and so are the
+// _test.go files unless includeTests is set.
+func (g CoverageList) MissingFiles(srcRoot string, includeTests bool) []string {
+	modPath := modulePathOf(srcRoot)
+	known := make(map[string]bool)
+	for _, c := range g {
+		for _, rel := range sourceRelPaths(modPath, c.FileName) {
+			known[rel] = true
+		}
+	}
+
+	var missing []string
+	filepath.Walk(srcRoot, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		name := info.Name()
+		if info.IsDir() {
+			if p != srcRoot && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(name, ".go") || (!includeTests && strings.HasSuffix(name, "_test.go")) {
+			return nil
+		}
+		rel, err := filepath.Rel(srcRoot, p)
+		if err != nil {
+			return nil
+		}
+		if rel = filepath.ToSlash(rel); !known[rel] {
+			missing = append(missing, rel)
+		}
+		return nil
+	})
+	return missing
+}
+
+// DeadFiles returns the .go files under srcRoot which are in none of the lists, e.g. the
+// profiles of every suite of a full test matrix: never being compiled into any of them,
+// they are likely dead code or escape the builds. The files are matched and skipped
+// like MissingFiles.
+func DeadFiles(srcRoot string, includeTests bool, lists ...CoverageList) []string {
+	var all CoverageList
+	for _, list := range lists {
+		for _, c := range list {
+			all = append(all, Coverage{FileName: c.FileName})
+		}
+	}
+	return all.MissingFiles(srcRoot, includeTests)
+}
+
+// modulePathOf returns the module path of the go.mod in dir, empty if there is none
+func modulePathOf(dir string) string {
+	content, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+	return modfile.ModulePath(content)
+}
+
+// ResolvePaths maps every file name of the list to its path on disk. goPathOrModule is
+// either a module root containing a go.mod, whose module path prefixes the file names,
+// or a GOPATH whose src directory contains the import paths. The files which can not be
+// found are listed in the returned error, the resolved ones are always returned.
+func (g CoverageList) ResolvePaths(goPathOrModule string) (map[string]string, error) {
+	modPath := modulePathOf(goPathOrModule)
+
+	paths := make(map[string]string)
+	var unresolved []string
+	for _, c := range g {
+		if _, ok := paths[c.FileName]; ok {
+			continue
+		}
+		p, ok := resolvePath(goPathOrModule, modPath, c.FileName)
+		if !ok {
+			unresolved = append(unresolved, c.FileName)
+			continue
+		}
+		paths[c.FileName] = p
+	}
+	if len(unresolved) > 0 {
+		return paths, fmt.Errorf("unresolved files under %s: [%s]", goPathOrModule, strings.Join(unresolved, ", "))
+	}
+	return paths, nil
+}
+
+func resolvePath(root, modPath, fileName string) (string, bool) {
+	name := filepath.ToSlash(fileName)
+	if modPath != "" && strings.HasPrefix(name, modPath+"/") {
+		p := filepath.Join(root, filepath.FromSlash(strings.TrimPrefix(name, modPath+"/")))
+		if isFileExist(p) {
+			return p, true
+		}
+	}
+	if p := filepath.Join(root, "src", filepath.FromSlash(name)); isFileExist(p) {
+		return p, true
+	}
+	return sourcePath(root, fileName)
+}
@@ -0,0 +1,455 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testFooSource = `package foo
+
+import "fmt"
+
+// Foo is exported
+func Foo(a int) int {
+	if a > 0 {
+		return bar(a)
+	}
+	return 0
+}
+
+func bar(a int) int {
+	fmt.Println(a)
+	return a + 1
+}
+
+type T struct{}
+
+// String is an exported method
+func (t T) String() string {
+	return "T"
+}
+`
+
+const testFooProfile = "mode: count\n" +
+	"example.com/foo/foo.go:6.21,7.11 1 2\n" +
+	"example.com/foo/foo.go:7.11,9.3 1 1\n" +
+	"example.com/foo/foo.go:10.2,10.10 1 0\n" +
+	"example.com/foo/foo.go:13.21,16.2 2 1\n" +
+	"example.com/foo/foo.go:21.28,23.2 1 0\n"
+
+// writeTestSource writes the files to a temporary source tree and returns its root
+func writeTestSource(t *testing.T, files map[string]string) string {
+	root, err := ioutil.TempDir("", "goc-source-test")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		assert.NoError(t, ioutil.WriteFile(p, []byte(content), 0644))
+	}
+	return root
+}
+
+func TestSourcePath(t *testing.T) {
+	root := writeTestSource(t, map[string]string{"foo/foo.go": testFooSource})
+	defer os.RemoveAll(root)
+
+	p, ok := sourcePath(root, "example.com/foo/foo.go")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(root, "foo", "foo.go"), p)
+
+	_, ok = sourcePath(root, "example.com/bar/bar.go")
+	assert.False(t, ok)
+	// never down to the base name, which may be any other foo.go
+	_, ok = sourcePath(root, "example.com/baz/foo.go")
+	assert.False(t, ok)
+
+	mod := writeTestSource(t, map[string]string{
+		"go.mod":       "module example.com/m\n",
+		"main.go":      "package main\n",
+		"cmd/a/a.go":   "package main\n",
+		"m/cmd/a/a.go": "package main\n",
+	})
+	defer os.RemoveAll(mod)
+	p, ok = sourcePath(mod, "example.com/m/main.go")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(mod, "main.go"), p)
+	p, ok = sourcePath(mod, "example.com/m/cmd/a/a.go")
+	assert.True(t, ok)
+	assert.Equal(t, filepath.Join(mod, "cmd", "a", "a.go"), p)
+	_, ok = sourcePath(mod, "example.com/m/cmd/b/main.go")
+	assert.False(t, ok)
+	_, ok = sourcePath(mod, "example.com/other/m/cmd/a/a.go")
+	assert.False(t, ok)
+}
+
+func TestExportedCoverage(t *testing.T) {
+	root := writeTestSource(t, map[string]string{"example.com/foo/foo.go": testFooSource})
+	defer os.RemoveAll(root)
+
+	list, err := CovList(strings.NewReader(testFooProfile))
+	assert.NoError(t, err)
+	assert.NoError(t, list.AttachFuncNames(root))
+
+	var names []string
+	for _, b := range list[0].Blocks {
+		names = append(names, b.FuncName)
+	}
+	assert.Equal(t, []string{"Foo", "Foo", "Foo", "bar", "String"}, names)
+
+	exported := list.ExportedCoverage()
+	assert.Equal(t, 1, len(exported))
+	assert.Equal(t, 2, exported[0].NCoveredStmts)
+	assert.Equal(t, 4, exported[0].NAllStmts)
+
+	err = CoverageList{Coverage{FileName: "example.com/bar/bar.go"}}.AttachFuncNames(root)
+	assert.Error(t, err)
+}
+
+func TestCovListWithFuncs(t *testing.T) {
+	root := writeTestSource(t, map[string]string{"example.com/foo/foo.go": testFooSource})
+	defer os.RemoveAll(root)
+
+	var warnings []string
+	cache := NewFuncCache(root)
+	opts := ParseOptions{Funcs: cache, OnWarning: func(msg string) { warnings = append(warnings, msg) }}
+	profile := testFooProfile + "example.com/bar/bar.go:1.1,2.1 1 0\n" + "example.com/bar/bar.go:3.1,4.1 1 0\n"
+	list, err := CovListWithOptions(strings.NewReader(profile), opts)
+	assert.NoError(t, err)
+	var names []string
+	for _, b := range list[0].Blocks {
+		names = append(names, b.FuncName)
+	}
+	assert.Equal(t, []string{"Foo", "Foo", "Foo", "bar", "String"}, names)
+	assert.Equal(t, "", list[1].Blocks[0].FuncName)
+	// a missing file is reported once
+	assert.Equal(t, 1, len(warnings))
+	assert.Contains(t, warnings[0], "example.com/bar/bar.go")
+
+	// the parsed files are cached for the later profiles
+	assert.NoError(t, os.RemoveAll(filepath.Join(root, "example.com")))
+	list, err = CovListWithOptions(strings.NewReader(testFooProfile), opts)
+	assert.NoError(t, err)
+	assert.Equal(t, "String", list[0].Blocks[4].FuncName)
+
+	bad := writeTestSource(t, map[string]string{"example.com/foo/foo.go": "package foo\nfunc {"})
+	defer os.RemoveAll(bad)
+	_, err = CovListWithOptions(strings.NewReader(testFooProfile), ParseOptions{Funcs: NewFuncCache(bad)})
+	assert.Error(t, err)
+}
+
+func TestExcludeFuncs(t *testing.T) {
+	root := writeTestSource(t, map[string]string{"example.com/foo/foo.go": testFooSource})
+	defer os.RemoveAll(root)
+
+	list, err := CovList(strings.NewReader(testFooProfile))
+	assert.NoError(t, err)
+	assert.NoError(t, list.AttachFuncNames(root))
+
+	items := []struct {
+		names         []string
+		expectCovered int
+		expectAll     int
+	}{
+		{names: nil, expectCovered: 4, expectAll: 6},
+		{names: []string{"String"}, expectCovered: 4, expectAll: 5},
+		{names: []string{"b*", "Str?ng"}, expectCovered: 2, expectAll: 3},
+	}
+	for _, tc := range items {
+		res, err := list.ExcludeFuncs(tc.names)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expectCovered, res[0].NCoveredStmts)
+		assert.Equal(t, tc.expectAll, res[0].NAllStmts)
+	}
+
+	_, err = list.ExcludeFuncs([]string{"[a"})
+	assert.Error(t, err)
+}
+
+func TestDetectStale(t *testing.T) {
+	root := writeTestSource(t, map[string]string{
+		"example.com/foo/foo.go": testFooSource,
+		"example.com/foo/bar.go": "package foo\n\nfunc bar() {\n}",
+	})
+	defer os.RemoveAll(root)
+
+	profile := testFooProfile +
+		"example.com/foo/bar.go:3.12,4.2 0 0\n" +
+		"example.com/foo/baz.go:30.12,40.2 1 0\n"
+	list, err := CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Empty(t, list.DetectStale(root))
+
+	profile += "example.com/foo/bar.go:5.12,6.2 1 0\n"
+	list, err = CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com/foo/bar.go"}, list.DetectStale(root))
+}
+
+func TestMissingFiles(t *testing.T) {
+	root := writeTestSource(t, map[string]string{
+		"foo/foo.go":          testFooSource,
+		"foo/foo_test.go":     "package foo\n",
+		"foo/bar.go":          "package foo\n",
+		"foo/README.md":       "# foo\n",
+		"foo/vendor/x/x.go":   "package x\n",
+		"foo/testdata/t.go":   "package t\n",
+		"foo/.git/hook.go":    "package hook\n",
+		"foo/_example/e.go":   "package e\n",
+		"foo/internal/baz.go": "package internal\n",
+	})
+	defer os.RemoveAll(root)
+
+	list, err := CovList(strings.NewReader(testFooProfile))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo/bar.go", "foo/internal/baz.go"}, list.MissingFiles(root, false))
+	assert.Equal(t, []string{"foo/bar.go", "foo/foo_test.go", "foo/internal/baz.go"}, list.MissingFiles(root, true))
+	assert.Empty(t, list.MissingFiles(filepath.Join(root, "foo", "internal", "baz.go", "nonexist"), false))
+}
+
+func TestMissingFilesOfModule(t *testing.T) {
+	root := writeTestSource(t, map[string]string{
+		"go.mod":          "module example.com/m\n",
+		"doc.go":          "package m\n",
+		"main.go":         "package main\n",
+		"cmd/a/main.go":   "package main\n",
+		"cmd/a/doc.go":    "package main\n",
+		"internal/x/x.go": "package x\n",
+	})
+	defer os.RemoveAll(root)
+
+	list := CoverageList{
+		Coverage{FileName: "example.com/m/cmd/a/main.go"},
+		Coverage{FileName: "example.com/m/cmd/a/doc.go"},
+		Coverage{FileName: "example.com/other/internal/x/x.go"},
+	}
+	assert.Equal(t, []string{"doc.go", "internal/x/x.go", "main.go"}, list.MissingFiles(root, false))
+
+	list = append(list, Coverage{FileName: "example.com/m/main.go"}, Coverage{FileName: "example.com/m/internal/x/x.go"})
+	assert.Equal(t, []string{"doc.go"}, list.MissingFiles(root, false))
+}
+
+func TestDeadFiles(t *testing.T) {
+	root := writeTestSource(t, map[string]string{
+		"foo/foo.go":      testFooSource,
+		"foo/foo_test.go": "package foo\n",
+		"foo/bar.go":      "package foo\n",
+		"foo/dead.go":     "package foo\n",
+		"baz/baz.go":      "package baz\n",
+	})
+	defer os.RemoveAll(root)
+
+	unit, err := CovList(strings.NewReader(testFooProfile))
+	assert.NoError(t, err)
+	e2e := CoverageList{
+		Coverage{FileName: "example.com/foo/bar.go", NAllStmts: 1},
+		Coverage{FileName: "example.com/baz/baz.go", NAllStmts: 1},
+	}
+	assert.Equal(t, []string{"foo/dead.go"}, DeadFiles(root, false, unit, e2e))
+	assert.Equal(t, []string{"foo/dead.go", "foo/foo_test.go"}, DeadFiles(root, true, unit, e2e))
+	assert.Equal(t, []string{"baz/baz.go", "foo/bar.go", "foo/dead.go"}, DeadFiles(root, false, unit))
+	assert.Equal(t, 4, len(DeadFiles(root, false)))
+}
+
+func TestExcludeLines(t *testing.T) {
+	source := "package foo\n\nimport \"log\"\n\n" +
+		"func Foo(debug bool) int {\n" +
+		"\tif debug {\n" +
+		"\t\tlog.Println(\"debug\")\n" +
+		"\t}\n" +
+		"\tx := 1\n" +
+		"\tlog.Println(\"x\", x)\n" +
+		"\treturn x\n" +
+		"}\n"
+	root := writeTestSource(t, map[string]string{"example.com/foo/foo.go": source})
+	defer os.RemoveAll(root)
+
+	profile := "mode: set\n" +
+		"example.com/foo/foo.go:5.27,6.11 1 1\n" +
+		"example.com/foo/foo.go:6.11,8.3 1 0\n" +
+		"example.com/foo/foo.go:8.3,11.10 3 1\n"
+	list, err := CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, "80.0%", list.TotalPercentage())
+
+	items := []struct {
+		patterns []string
+		expect   string
+		blocks   int
+	}{
+		{patterns: []string{`^log\.`}, expect: "100.0%", blocks: 2},
+		{patterns: []string{`^log\.Printf`}, expect: "80.0%", blocks: 3},
+		{patterns: nil, expect: "80.0%", blocks: 3},
+	}
+	for _, tc := range items {
+		res, err := list.ExcludeLines(root, tc.patterns)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, res.TotalPercentage())
+		assert.Equal(t, tc.blocks, len(res[0].Blocks))
+		assert.Equal(t, "set", res[0].Mode)
+	}
+
+	_, err = list.ExcludeLines(root, []string{"("})
+	assert.Error(t, err)
+
+	list = append(list, Coverage{FileName: "example.com/foo/bar.go", NCoveredStmts: 1, NAllStmts: 1,
+		Blocks: []CoverBlock{{FileName: "example.com/foo/bar.go", StartLine: 1, EndLine: 2, NumStmt: 1, Count: 1}}})
+	res, err := list.ExcludeLines(root, []string{`^log\.`})
+	assert.Error(t, err)
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, "100.0%", res.TotalPercentage())
+}
+
+func TestExcludeDeprecated(t *testing.T) {
+	source := "package foo\n\n" +
+		"// Old does it the old way.\n" +
+		"//\n" +
+		"// Deprecated: use New.\n" +
+		"func Old() int {\n" +
+		"\treturn 1\n" +
+		"}\n\n" +
+		"// New does it.\n" +
+		"func New() int {\n" +
+		"\treturn 2\n" +
+		"}\n\n" +
+		"// Deprecated: use New.\n" +
+		"type T struct{}\n\n" +
+		"func (t *T) Get() int {\n" +
+		"\treturn 3\n" +
+		"}\n"
+	root := writeTestSource(t, map[string]string{"example.com/foo/foo.go": source})
+	defer os.RemoveAll(root)
+
+	profile := "mode: set\n" +
+		"example.com/foo/foo.go:6.16,8.2 1 0\n" +
+		"example.com/foo/foo.go:11.16,13.2 1 1\n" +
+		"example.com/foo/foo.go:18.24,20.2 1 0\n"
+	list, err := CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+	assert.Equal(t, "33.3%", list.TotalPercentage())
+
+	res, err := list.ExcludeDeprecated(root)
+	assert.NoError(t, err)
+	assert.Equal(t, "100.0%", res.TotalPercentage())
+	if assert.Equal(t, 1, len(res)) {
+		assert.Equal(t, 1, len(res[0].Blocks))
+		assert.Equal(t, 11, res[0].Blocks[0].StartLine)
+	}
+
+	list = append(list, Coverage{FileName: "example.com/foo/bar.go", NCoveredStmts: 0, NAllStmts: 1,
+		Blocks: []CoverBlock{{FileName: "example.com/foo/bar.go", StartLine: 1, EndLine: 2, NumStmt: 1}}})
+	res, err = list.ExcludeDeprecated(root)
+	assert.Error(t, err)
+	assert.Equal(t, 2, len(res))
+	assert.Equal(t, "50.0%", res.TotalPercentage())
+}
+
+func TestExcludeUnbuiltFiles(t *testing.T) {
+	root := writeTestSource(t, map[string]string{
+		"example.com/foo/foo.go":       "package foo\n",
+		"example.com/foo/foo_linux.go": "// Copyright\n\n//go:build linux && !integration\n\npackage foo\n",
+		"example.com/foo/foo_win.go":   "// license\n\n// +build windows\n// +build amd64\n\npackage foo\n",
+		"example.com/foo/foo_late.go":  "package foo\n\n//go:build ignore\n",
+		// the file names constrain GOOS and GOARCH too
+		"example.com/foo/foo_windows.go":     "package foo\n",
+		"example.com/foo/foo_linux_arm64.go": "package foo\n",
+	})
+	defer os.RemoveAll(root)
+
+	profile := "mode: set\n" +
+		"example.com/foo/foo.go:1.1,2.2 1 1\n" +
+		"example.com/foo/foo_late.go:1.1,2.2 1 1\n" +
+		"example.com/foo/foo_linux.go:1.1,2.2 1 1\n" +
+		"example.com/foo/foo_win.go:1.1,2.2 1 0\n" +
+		"example.com/foo/foo_windows.go:1.1,2.2 1 0\n" +
+		"example.com/foo/foo_linux_arm64.go:1.1,2.2 1 0\n"
+	list, err := CovList(strings.NewReader(profile))
+	assert.NoError(t, err)
+
+	items := []struct {
+		tags   []string
+		expect []string
+	}{
+		{tags: []string{"linux", "amd64"}, expect: []string{"foo.go", "foo_late.go", "foo_linux.go"}},
+		{tags: []string{"linux", "arm64"}, expect: []string{"foo.go", "foo_late.go", "foo_linux.go", "foo_linux_arm64.go"}},
+		{tags: []string{"linux", "integration"}, expect: []string{"foo.go", "foo_late.go"}},
+		{tags: []string{"windows", "amd64"}, expect: []string{"foo.go", "foo_late.go", "foo_win.go", "foo_windows.go"}},
+		{tags: []string{"windows", "arm64"}, expect: []string{"foo.go", "foo_late.go", "foo_windows.go"}},
+	}
+	for _, tc := range items {
+		res, err := list.ExcludeUnbuiltFiles(root, tc.tags)
+		assert.NoError(t, err)
+		var names []string
+		for _, c := range res {
+			names = append(names, strings.TrimPrefix(c.FileName, "example.com/foo/"))
+		}
+		assert.Equal(t, tc.expect, names, "tags %v", tc.tags)
+	}
+
+	missing := append(list, Coverage{FileName: "example.com/foo/gone.go"})
+	res, err := missing.ExcludeUnbuiltFiles(root, []string{"linux"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "example.com/foo/gone.go")
+	assert.Equal(t, 4, len(res))
+
+	bad := writeTestSource(t, map[string]string{"example.com/foo/foo.go": "//go:build linux &&\n\npackage foo\n"})
+	defer os.RemoveAll(bad)
+	_, err = list[:1].ExcludeUnbuiltFiles(bad, nil)
+	assert.Error(t, err)
+}
+
+func TestResolvePaths(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "example.com/foo/foo.go"},
+		Coverage{FileName: "example.com/foo/bar/bar.go"},
+		Coverage{FileName: "example.com/baz/baz.go"},
+	}
+
+	// module root
+	root := writeTestSource(t, map[string]string{
+		"go.mod":     "module example.com/foo\n",
+		"foo.go":     testFooSource,
+		"bar/bar.go": "package bar\n",
+	})
+	defer os.RemoveAll(root)
+	paths, err := list.ResolvePaths(root)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "example.com/baz/baz.go")
+	assert.Equal(t, map[string]string{
+		"example.com/foo/foo.go":     filepath.Join(root, "foo.go"),
+		"example.com/foo/bar/bar.go": filepath.Join(root, "bar", "bar.go"),
+	}, paths)
+
+	// gopath
+	gopath := writeTestSource(t, map[string]string{
+		"src/example.com/foo/foo.go":     testFooSource,
+		"src/example.com/foo/bar/bar.go": "package bar\n",
+		"src/example.com/baz/baz.go":     "package baz\n",
+	})
+	defer os.RemoveAll(gopath)
+	paths, err = list.ResolvePaths(gopath)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(gopath, "src", "example.com", "baz", "baz.go"), paths["example.com/baz/baz.go"])
+}
@@ -24,8 +24,6 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
-
-	log "github.com/sirupsen/logrus"
 )
 
 var ErrServiceAlreadyRegistered = errors.New("service already registered")
@@ -75,7 +73,7 @@ func NewFileStore(persistenceFile string) (store Store, err error) {
 	}
 
 	if err := l.load(); err != nil {
-		log.Fatalf("load failed, file: %s, err: %v", l.persistentFile, err)
+		return nil, fmt.Errorf("load failed, file: %s, err: %v", l.persistentFile, err)
 	}
 
 	return l, nil
@@ -249,7 +247,7 @@ func (l *memoryStore) Add(s ServiceUnderTest) error {
 	if addrs, ok := l.servicesMap[s.Name]; ok {
 		for _, addr := range addrs {
 			if addr == s.Address {
-				log.Printf("service registered already, name: %s, address: %s", s.Name, s.Address)
+				logger.Printf("service registered already, name: %s, address: %s", s.Name, s.Address)
 				return ErrServiceAlreadyRegistered
 			}
 		}
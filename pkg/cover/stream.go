@@ -0,0 +1,277 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// BlockExporter consumes the blocks of a profile one by one
+type BlockExporter interface {
+	// OnBlock is called for every block in profile order
+	OnBlock(b CoverBlock) error
+	// Finish is called once all the blocks are consumed
+	Finish() error
+}
+
+// CovListStream parses the profile and feeds every block to all the exporters at the same time,
+// so that the profile is read once whatever the number of outputs. The memory each exporter needs
+// is documented with its constructor. It returns the mode of the profile.
+func CovListStream(r io.Reader, exporters ...BlockExporter) (mode string, err error) {
+	mode, err = scanProfile(r, func(blk *CoverBlock) error {
+		for _, e := range exporters {
+			if err := e.OnBlock(*blk); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, e := range exporters {
+		if err := e.Finish(); err != nil {
+			return "", err
+		}
+	}
+	return mode, nil
+}
+
+// textExporter sums the statements per file and writes them like CoverageList.WriteText
+type textExporter struct {
+	w    io.Writer
+	list CoverageList
+}
+
+// NewTextExporter returns a BlockExporter writing the layout of CoverageList.WriteText
+func NewTextExporter(w io.Writer) BlockExporter {
+	return &textExporter{w: w, list: NewCoverageList()}
+}
+
+func (e *textExporter) OnBlock(b CoverBlock) error {
+	// only the counts are needed, do not retain the block
+	if e.list.size() == 0 || e.list.lastElement().Name() != b.FileName {
+		e.list.append(newCoverage(b.FileName))
+	}
+	cov := e.list.lastElement()
+	cov.NAllStmts += b.NumStmt
+	if b.Count > 0 {
+		cov.NCoveredStmts += b.NumStmt
+	}
+	return nil
+}
+
+func (e *textExporter) Finish() error {
+	return e.list.Coalesce().WriteText(e.w)
+}
+
+// lineHits records the hit count per line of one file, a line takes the max count of its blocks
+type lineHits map[int]int64
+
+func (h lineHits) add(b *CoverBlock) {
+	if b.NumStmt == 0 {
+		return
+	}
+	for l := b.StartLine; l <= b.EndLine; l++ {
+		if count, ok := h[l]; !ok || b.Count > count {
+			h[l] = b.Count
+		}
+	}
+}
+
+func (h lineHits) sortedLines() []int {
+	lines := make([]int, 0, len(h))
+	for l := range h {
+		lines = append(lines, l)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+func (h lineHits) covered() int {
+	n := 0
+	for _, count := range h {
+		if count > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// lcovExporter writes an LCOV tracefile, one record per run of blocks of the same file,
+// only the line hits of the current file are kept
+type lcovExporter struct {
+	w    io.Writer
+	file string
+	hits lineHits
+}
+
+// NewLCOVExporter returns a BlockExporter writing an LCOV tracefile. The blocks of a file must be
+// grouped together, as in the profiles written by go test and goc: a file which reappears later
+// in the stream gets another SF record, so merge such a profile first to get one record per file.
+func NewLCOVExporter(w io.Writer) BlockExporter {
+	return &lcovExporter{w: w}
+}
+
+func (e *lcovExporter) OnBlock(b CoverBlock) error {
+	if e.hits != nil && e.file != b.FileName {
+		if err := e.flush(); err != nil {
+			return err
+		}
+	}
+	if e.hits == nil {
+		e.file = b.FileName
+		e.hits = make(lineHits)
+	}
+	e.hits.add(&b)
+	return nil
+}
+
+func (e *lcovExporter) flush() error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "SF:%s\n", e.file)
+	for _, l := range e.hits.sortedLines() {
+		fmt.Fprintf(&sb, "DA:%d,%d\n", l, e.hits[l])
+	}
+	fmt.Fprintf(&sb, "LF:%d\nLH:%d\nend_of_record\n", len(e.hits), e.hits.covered())
+	e.hits = nil
+	_, err := io.WriteString(e.w, sb.String())
+	return err
+}
+
+func (e *lcovExporter) Finish() error {
+	if e.hits == nil {
+		return nil
+	}
+	return e.flush()
+}
+
+// coberturaExporter collects the line hits per file and writes a Cobertura report at the end,
+// the report groups the files by package so it can not be written before all blocks are seen
+type coberturaExporter struct {
+	w     io.Writer
+	files map[string]lineHits
+}
+
+// NewCoberturaExporter returns a BlockExporter writing a Cobertura XML report. Unlike the text
+// and LCOV exporters, it keeps the line hits of all the files until Finish, so its memory grows
+// with the number of covered lines of the profile.
+func NewCoberturaExporter(w io.Writer) BlockExporter {
+	return &coberturaExporter{w: w, files: make(map[string]lineHits)}
+}
+
+func (e *coberturaExporter) OnBlock(b CoverBlock) error {
+	h, ok := e.files[b.FileName]
+	if !ok {
+		h = make(lineHits)
+		e.files[b.FileName] = h
+	}
+	h.add(&b)
+	return nil
+}
+
+type coberturaCoverage struct {
+	XMLName      xml.Name           `xml:"coverage"`
+	LineRate     string             `xml:"line-rate,attr"`
+	LinesCovered int                `xml:"lines-covered,attr"`
+	LinesValid   int                `xml:"lines-valid,attr"`
+	Packages     []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name     string           `xml:"name,attr"`
+	LineRate string           `xml:"line-rate,attr"`
+	Classes  []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name     string          `xml:"name,attr"`
+	Filename string          `xml:"filename,attr"`
+	LineRate string          `xml:"line-rate,attr"`
+	Lines    []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number int   `xml:"number,attr"`
+	Hits   int64 `xml:"hits,attr"`
+}
+
+func lineRate(covered, valid int) string {
+	if valid == 0 {
+		return "0"
+	}
+	return fmt.Sprintf("%.4f", float64(covered)/float64(valid))
+}
+
+func (e *coberturaExporter) Finish() error {
+	var files []string
+	for file := range e.files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	report := coberturaCoverage{}
+	pkgIndex := make(map[string]int)
+	pkgCounts := make(map[string][2]int)
+	for _, file := range files {
+		h := e.files[file]
+		class := coberturaClass{
+			Name:     path.Base(file),
+			Filename: file,
+			LineRate: lineRate(h.covered(), len(h)),
+		}
+		for _, l := range h.sortedLines() {
+			class.Lines = append(class.Lines, coberturaLine{Number: l, Hits: h[l]})
+		}
+
+		pkg := path.Dir(file)
+		i, ok := pkgIndex[pkg]
+		if !ok {
+			i = len(report.Packages)
+			pkgIndex[pkg] = i
+			report.Packages = append(report.Packages, coberturaPackage{Name: pkg})
+		}
+		report.Packages[i].Classes = append(report.Packages[i].Classes, class)
+		counts := pkgCounts[pkg]
+		counts[0] += h.covered()
+		counts[1] += len(h)
+		pkgCounts[pkg] = counts
+		report.LinesCovered += h.covered()
+		report.LinesValid += len(h)
+	}
+	for i := range report.Packages {
+		counts := pkgCounts[report.Packages[i].Name]
+		report.Packages[i].LineRate = lineRate(counts[0], counts[1])
+	}
+	report.LineRate = lineRate(report.LinesCovered, report.LinesValid)
+
+	if _, err := io.WriteString(e.w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(e.w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(e.w, "\n")
+	return err
+}
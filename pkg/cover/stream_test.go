@@ -0,0 +1,85 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCovListStream(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	fileName1 := "qiniu.com/kodo/apiserver/server/svr.go"
+	profile := "mode: count\n" +
+		fileName + ":32.49,33.13 1 30\n" +
+		fileName + ":33.14,33.30 1 0\n" +
+		fileName + ":42.49,43.13 1 0\n" +
+		fileName1 + ":10.1,10.20 1 2\n"
+
+	var text, lcov, cobertura bytes.Buffer
+	mode, err := CovListStream(strings.NewReader(profile),
+		NewTextExporter(&text), NewLCOVExporter(&lcov), NewCoberturaExporter(&cobertura))
+	assert.NoError(t, err)
+	assert.Equal(t, "count", mode)
+
+	assert.Equal(t, "  33.3%  "+fileName+"\n"+
+		" 100.0%  "+fileName1+"\n"+
+		"  50.0%  Total\n", text.String())
+
+	assert.Equal(t, "SF:"+fileName+"\n"+
+		"DA:32,30\nDA:33,30\nDA:42,0\nDA:43,0\n"+
+		"LF:4\nLH:2\nend_of_record\n"+
+		"SF:"+fileName1+"\n"+
+		"DA:10,2\n"+
+		"LF:1\nLH:1\nend_of_record\n", lcov.String())
+
+	assert.Contains(t, cobertura.String(), `<coverage line-rate="0.6000" lines-covered="3" lines-valid="5">`)
+	assert.Contains(t, cobertura.String(), `<package name="qiniu.com/kodo/apiserver/server" line-rate="0.6000">`)
+	assert.Contains(t, cobertura.String(), `<class name="svr.go" filename="`+fileName1+`" line-rate="1.0000">`)
+	assert.Contains(t, cobertura.String(), `<line number="42" hits="0"></line>`)
+
+	_, err = CovListStream(strings.NewReader(fileName+":32.49,33.13 1 30\n"), NewTextExporter(&text))
+	assert.Error(t, err)
+}
+
+func TestLCOVExporterUngroupedFiles(t *testing.T) {
+	fileName := "qiniu.com/kodo/apiserver/server/main.go"
+	fileName1 := "qiniu.com/kodo/apiserver/server/svr.go"
+	profile := "mode: count\n" +
+		fileName + ":32.49,33.13 1 30\n" +
+		fileName1 + ":10.1,10.20 1 2\n" +
+		fileName + ":42.49,43.13 1 0\n"
+
+	var lcov bytes.Buffer
+	_, err := CovListStream(strings.NewReader(profile), NewLCOVExporter(&lcov))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(lcov.String(), "SF:"+fileName+"\n"))
+
+	// merged first, the profile gives one record per file
+	a := NewAccumulator(MergeSum)
+	assert.NoError(t, a.Add(strings.NewReader(profile)))
+	var merged bytes.Buffer
+	assert.NoError(t, a.List().WriteProfile(&merged))
+	lcov.Reset()
+	_, err = CovListStream(&merged, NewLCOVExporter(&lcov))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(lcov.String(), "SF:"+fileName+"\n"))
+	assert.Contains(t, lcov.String(), "DA:32,30\nDA:33,30\nDA:42,0\nDA:43,0\n")
+}
@@ -0,0 +1,169 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	treemapWidth  = 960
+	treemapHeight = 600
+)
+
+// svgRect is a rectangle of an svg image
+type svgRect struct {
+	x, y, w, h float64
+}
+
+// WriteTreemapSVG writes an svg treemap of the packages, the area of each rectangle is
+// the statement count of the package and its color goes from red to green by coverage ratio.
+// The packages without statements are left out.
+func (g CoverageList) WriteTreemapSVG(w io.Writer) error {
+	var pkgs CoverageList
+	for _, p := range g.GroupByPackage() {
+		if p.NAllStmts > 0 {
+			pkgs = append(pkgs, p)
+		}
+	}
+	sort.SliceStable(pkgs, func(i, j int) bool { return pkgs[i].NAllStmts > pkgs[j].NAllStmts })
+	weights := make([]int, len(pkgs))
+	for i := range pkgs {
+		weights[i] = pkgs[i].NAllStmts
+	}
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		treemapWidth, treemapHeight, treemapWidth, treemapHeight)
+	rects := layoutTreemap(weights, svgRect{0, 0, treemapWidth, treemapHeight})
+	for i, r := range rects {
+		p := &pkgs[i]
+		ratio, _ := p.Ratio()
+		fmt.Fprintf(bw, `<g><title>%s %s (%d/%d)</title>`, svgEscape(p.Name()), p.Percentage(), p.NCoveredStmts, p.NAllStmts)
+		fmt.Fprintf(bw, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s" stroke="#fff"/>`,
+			r.x, r.y, r.w, r.h, ratioColor(ratio))
+		// only label the rectangles large enough to hold the text
+		if r.w >= 60 && r.h >= 16 {
+			fmt.Fprintf(bw, `<text x="%.1f" y="%.1f" font-family="sans-serif" font-size="11" fill="#fff">%s</text>`,
+				r.x+4, r.y+13, svgEscape(path.Base(p.Name())))
+		}
+		fmt.Fprintln(bw, `</g>`)
+	}
+	fmt.Fprintln(bw, `</svg>`)
+	return bw.Flush()
+}
+
+// layoutTreemap splits r into one rectangle per weight with an area proportional to it,
+// the weights are split into two halves of close total recursively along the longer side
+func layoutTreemap(weights []int, r svgRect) []svgRect {
+	if len(weights) == 0 {
+		return nil
+	}
+	if len(weights) == 1 {
+		return []svgRect{r}
+	}
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	k, left := 1, weights[0]
+	for k < len(weights)-1 && 2*(left+weights[k]) <= total {
+		left += weights[k]
+		k++
+	}
+
+	frac := float64(left) / float64(total)
+	var a, b svgRect
+	if r.w >= r.h {
+		a = svgRect{r.x, r.y, r.w * frac, r.h}
+		b = svgRect{r.x + a.w, r.y, r.w - a.w, r.h}
+	} else {
+		a = svgRect{r.x, r.y, r.w, r.h * frac}
+		b = svgRect{r.x, r.y + a.h, r.w, r.h - a.h}
+	}
+	return append(layoutTreemap(weights[:k], a), layoutTreemap(weights[k:], b)...)
+}
+
+// ratioColor interpolates from red at 0 to green at 1
+func ratioColor(ratio float32) string {
+	red, green := [3]float32{0xe0, 0x5d, 0x44}, [3]float32{0x44, 0xcc, 0x11}
+	var c [3]int
+	for i := range c {
+		c[i] = int(red[i] + (green[i]-red[i])*ratio + 0.5)
+	}
+	return fmt.Sprintf("#%02x%02x%02x", c[0], c[1], c[2])
+}
+
+// badgeCharWidth approximates the width of a character of the 11px badge font
+const badgeCharWidth = 7
+
+// badgeColor buckets the ratio of a badge: red below 50%, orange below 70%, yellow below 85%
+func badgeColor(ratio float32) string {
+	switch {
+	case ratio < 0.5:
+		return "#e05d44"
+	case ratio < 0.7:
+		return "#fe7d37"
+	case ratio < 0.85:
+		return "#dfb317"
+	default:
+		return "#4c1"
+	}
+}
+
+// WriteBadgeSVG writes a shields.io style badge of the label and the percentage of ratio,
+// e.g. to commit an up-to-date coverage badge for the README. The svg is self-contained,
+// its text widths are estimated from the character counts.
+func WriteBadgeSVG(w io.Writer, label string, ratio float32) error {
+	if !(ratio >= 0 && ratio <= 1) {
+		return fmt.Errorf("invalid coverage ratio %v", ratio)
+	}
+	value := PercentStr(ratio)
+	labelWidth := utf8.RuneCountInString(label)*badgeCharWidth + 10
+	valueWidth := len(value)*badgeCharWidth + 10
+	width := labelWidth + valueWidth
+	label, value = svgEscape(label), svgEscape(value)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="20" role="img" aria-label="%s: %s">`+"\n", width, label, value)
+	fmt.Fprintf(bw, `<title>%s: %s</title>`+"\n", label, value)
+	fmt.Fprint(bw, `<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+"\n")
+	fmt.Fprintf(bw, `<clipPath id="r"><rect width="%d" height="20" rx="3" fill="#fff"/></clipPath>`+"\n", width)
+	fmt.Fprint(bw, `<g clip-path="url(#r)">`+"\n")
+	fmt.Fprintf(bw, `<rect width="%d" height="20" fill="#555"/>`+"\n", labelWidth)
+	fmt.Fprintf(bw, `<rect x="%d" width="%d" height="20" fill="%s"/>`+"\n", labelWidth, valueWidth, badgeColor(ratio))
+	fmt.Fprintf(bw, `<rect width="%d" height="20" fill="url(#s)"/>`+"\n", width)
+	fmt.Fprint(bw, "</g>\n")
+	fmt.Fprint(bw, `<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+"\n")
+	fmt.Fprintf(bw, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`+"\n", labelWidth/2, label, labelWidth/2, label)
+	fmt.Fprintf(bw, `<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text><text x="%d" y="14">%s</text>`+"\n", labelWidth+valueWidth/2, value, labelWidth+valueWidth/2, value)
+	fmt.Fprint(bw, "</g>\n</svg>\n")
+	return bw.Flush()
+}
+
+func svgEscape(s string) string {
+	var sb strings.Builder
+	xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
@@ -0,0 +1,125 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"encoding/xml"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLayoutTreemap(t *testing.T) {
+	items := []struct {
+		weights []int
+	}{
+		{weights: nil},
+		{weights: []int{1}},
+		{weights: []int{50, 30, 10, 5, 5}},
+		{weights: []int{90, 1, 1}},
+	}
+	for _, tc := range items {
+		rects := layoutTreemap(tc.weights, svgRect{0, 0, 100, 50})
+		assert.Equal(t, len(tc.weights), len(rects))
+		total := 0
+		for _, w := range tc.weights {
+			total += w
+		}
+		for i, r := range rects {
+			assert.InDelta(t, 5000*float64(tc.weights[i])/float64(total), r.w*r.h, 1e-6)
+			assert.True(t, r.x >= 0 && r.y >= 0 && r.x+r.w <= 100+1e-9 && r.y+r.h <= 50+1e-9)
+		}
+	}
+}
+
+func TestRatioColor(t *testing.T) {
+	assert.Equal(t, "#e05d44", ratioColor(0))
+	assert.Equal(t, "#44cc11", ratioColor(1))
+	assert.Equal(t, "#92952b", ratioColor(0.5))
+}
+
+func TestWriteTreemapSVG(t *testing.T) {
+	list := CoverageList{
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/main.go", NCoveredStmts: 15, NAllStmts: 20},
+		Coverage{FileName: "qiniu.com/kodo/apiserver/server/svr.go", NCoveredStmts: 5, NAllStmts: 20},
+		Coverage{FileName: "qiniu.com/kodo/a&b/a.go", NCoveredStmts: 10, NAllStmts: 10},
+		Coverage{FileName: "qiniu.com/kodo/empty/empty.go"},
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, list.WriteTreemapSVG(&buf))
+
+	var svg struct {
+		Groups []struct {
+			Title string `xml:"title"`
+			Rect  struct {
+				Width  float64 `xml:"width,attr"`
+				Height float64 `xml:"height,attr"`
+				Fill   string  `xml:"fill,attr"`
+			} `xml:"rect"`
+		} `xml:"g"`
+	}
+	assert.NoError(t, xml.Unmarshal(buf.Bytes(), &svg))
+	assert.Equal(t, 2, len(svg.Groups))
+	assert.Equal(t, "qiniu.com/kodo/apiserver/server 50.0% (20/40)", svg.Groups[0].Title)
+	assert.Equal(t, "qiniu.com/kodo/a&b 100.0% (10/10)", svg.Groups[1].Title)
+	assert.Equal(t, "#44cc11", svg.Groups[1].Rect.Fill)
+	area := func(i int) float64 { return svg.Groups[i].Rect.Width * svg.Groups[i].Rect.Height }
+	assert.True(t, math.Abs(area(0)-4*area(1)) < area(0)/100)
+	assert.True(t, strings.HasPrefix(buf.String(), "<svg "))
+}
+
+func TestWriteBadgeSVG(t *testing.T) {
+	items := []struct {
+		ratio       float32
+		expectColor string
+	}{
+		{ratio: 0.2, expectColor: "#e05d44"},
+		{ratio: 0.6, expectColor: "#fe7d37"},
+		{ratio: 0.8, expectColor: "#dfb317"},
+		{ratio: 0.85, expectColor: "#4c1"},
+		{ratio: 1, expectColor: "#4c1"},
+	}
+	for _, tc := range items {
+		var buf bytes.Buffer
+		assert.NoError(t, WriteBadgeSVG(&buf, "coverage <go>", tc.ratio))
+
+		var svg struct {
+			Width  int    `xml:"width,attr"`
+			Title  string `xml:"title"`
+			Groups []struct {
+				Rects []struct {
+					Width int    `xml:"width,attr"`
+					Fill  string `xml:"fill,attr"`
+				} `xml:"rect"`
+				Texts []string `xml:"text"`
+			} `xml:"g"`
+		}
+		assert.NoError(t, xml.Unmarshal(buf.Bytes(), &svg))
+		assert.Equal(t, "coverage <go>: "+PercentStr(tc.ratio), svg.Title)
+		assert.Equal(t, tc.expectColor, svg.Groups[0].Rects[1].Fill)
+		assert.Equal(t, svg.Width, svg.Groups[0].Rects[0].Width+svg.Groups[0].Rects[1].Width)
+		assert.Equal(t, PercentStr(tc.ratio), svg.Groups[1].Texts[3])
+		assert.NotContains(t, buf.String(), "href")
+	}
+
+	for _, ratio := range []float32{-0.1, 1.1, float32(math.NaN())} {
+		assert.Error(t, WriteBadgeSVG(&bytes.Buffer{}, "coverage", ratio))
+	}
+}
@@ -0,0 +1,138 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"math"
+	"sort"
+)
+
+// TrendPoint is the coverage at one point of a history, e.g. a commit
+type TrendPoint struct {
+	Index int // ordinal of the point in the history
+	List  CoverageList
+}
+
+// CoverageTrendSlope returns the slope of the least squares regression line of the
+// total ratio over the index, i.e. the average ratio change per index step.
+// Points without any statement are skipped, and 0 is returned with fewer than two points.
+func CoverageTrendSlope(series []TrendPoint) float32 {
+	var xs, ys []float64
+	for _, p := range series {
+		ratio, err := p.List.TotalRatio()
+		if err != nil {
+			continue
+		}
+		xs = append(xs, float64(p.Index))
+		ys = append(ys, float64(ratio))
+	}
+	if len(xs) < 2 {
+		return 0
+	}
+
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+
+	var num, den float64
+	for i := range xs {
+		num += (xs[i] - meanX) * (ys[i] - meanY)
+		den += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	if den == 0 {
+		return 0
+	}
+	return float32(num / den)
+}
+
+// RatioSpread is the ratio of a file over repeated runs, e.g. of flaky integration tests
+type RatioSpread struct {
+	FileName string
+	Runs     int // runs in which the file has statements
+	Mean     float32
+	StdDev   float32 // population standard deviation of the ratios
+}
+
+// Low returns the lower bound of the interval, i.e. Mean - StdDev
+func (s RatioSpread) Low() float32 {
+	return s.Mean - s.StdDev
+}
+
+// High returns the upper bound of the interval, i.e. Mean + StdDev
+func (s RatioSpread) High() float32 {
+	return s.Mean + s.StdDev
+}
+
+// Unstable tells whether the interval straddles threshold, so that a gate at it may pass
+// or fail depending on the run.
+func (s RatioSpread) Unstable(threshold float32) bool {
+	return s.Low() < threshold && s.High() >= threshold
+}
+
+// RatioSpreads returns the mean ratio and its standard deviation of each file over the
+// runs, sorted by file name. A run in which the file is absent or has no statements
+// does not count for it.
+func RatioSpreads(runs ...CoverageList) []RatioSpread {
+	ratios := make(map[string][]float64)
+	for _, list := range runs {
+		for i := range list {
+			ratio, err := list[i].Ratio()
+			if err != nil {
+				continue
+			}
+			ratios[list[i].FileName] = append(ratios[list[i].FileName], float64(ratio))
+		}
+	}
+
+	spreads := make([]RatioSpread, 0, len(ratios))
+	for name, rs := range ratios {
+		var mean float64
+		for _, r := range rs {
+			mean += r
+		}
+		mean /= float64(len(rs))
+		var variance float64
+		for _, r := range rs {
+			variance += (r - mean) * (r - mean)
+		}
+		variance /= float64(len(rs))
+		spreads = append(spreads, RatioSpread{
+			FileName: name,
+			Runs:     len(rs),
+			Mean:     float32(mean),
+			StdDev:   float32(math.Sqrt(variance)),
+		})
+	}
+	sort.Slice(spreads, func(i, j int) bool { return spreads[i].FileName < spreads[j].FileName })
+	return spreads
+}
+
+// UnstableFiles returns the spreads of the files whose interval over the runs straddles
+// threshold, i.e. whose gate at threshold cannot be trusted.
+func UnstableFiles(threshold float32, runs ...CoverageList) []RatioSpread {
+	var unstable []RatioSpread
+	for _, s := range RatioSpreads(runs...) {
+		if s.Unstable(threshold) {
+			unstable = append(unstable, s)
+		}
+	}
+	return unstable
+}
@@ -0,0 +1,88 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func trendList(covered int) CoverageList {
+	return CoverageList{Coverage{FileName: "a", NCoveredStmts: covered, NAllStmts: 100}}
+}
+
+func TestCoverageTrendSlope(t *testing.T) {
+	items := []struct {
+		series []TrendPoint
+		expect float32
+	}{
+		{series: nil, expect: 0},
+		{series: []TrendPoint{{Index: 0, List: trendList(50)}}, expect: 0},
+		{
+			series: []TrendPoint{{Index: 0, List: trendList(80)}, {Index: 1, List: trendList(78)}, {Index: 2, List: trendList(76)}},
+			expect: -0.02,
+		},
+		{
+			series: []TrendPoint{{Index: 0, List: trendList(50)}, {Index: 2, List: trendList(60)},
+				{Index: 3, List: CoverageList{Coverage{FileName: "a"}}}},
+			expect: 0.05,
+		},
+	}
+
+	for _, tc := range items {
+		assert.InDelta(t, tc.expect, CoverageTrendSlope(tc.series), 1e-6)
+	}
+}
+
+func TestRatioSpreads(t *testing.T) {
+	run := func(a int, b ...int) CoverageList {
+		list := CoverageList{Coverage{FileName: "a", NCoveredStmts: a, NAllStmts: 100}, Coverage{FileName: "c"}}
+		for _, covered := range b {
+			list = append(list, Coverage{FileName: "b", NCoveredStmts: covered, NAllStmts: 10})
+		}
+		return list
+	}
+	runs := []CoverageList{run(70, 5), run(80), run(90, 5)}
+
+	spreads := RatioSpreads(runs...)
+	if assert.Equal(t, 2, len(spreads)) {
+		assert.Equal(t, "a", spreads[0].FileName)
+		assert.Equal(t, 3, spreads[0].Runs)
+		assert.InDelta(t, 0.8, spreads[0].Mean, 1e-6)
+		assert.InDelta(t, 0.0816497, spreads[0].StdDev, 1e-6)
+		assert.Equal(t, RatioSpread{FileName: "b", Runs: 2, Mean: 0.5}, spreads[1])
+	}
+	assert.Empty(t, RatioSpreads())
+
+	items := []struct {
+		threshold float32
+		expect    []string
+	}{
+		{threshold: 0.85, expect: []string{"a"}},
+		{threshold: 0.7, expect: nil},
+		{threshold: 0.5, expect: nil},
+		{threshold: 0.9, expect: nil},
+	}
+	for _, tc := range items {
+		var names []string
+		for _, s := range UnstableFiles(tc.threshold, runs...) {
+			names = append(names, s.FileName)
+		}
+		assert.Equal(t, tc.expect, names, "threshold %v", tc.threshold)
+	}
+}
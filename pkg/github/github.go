@@ -60,7 +60,7 @@ type GitPrComment struct {
 }
 
 // NewPrClient creates an Client which be able to comment on Github Pull Request
-func NewPrClient(githubTokenPath, repoOwner, repoName, prNumStr, botUserName, commentFlag string) *GitPrComment {
+func NewPrClient(githubTokenPath, repoOwner, repoName, prNumStr, botUserName, commentFlag string) (*GitPrComment, error) {
 	var client *github.Client
 
 	// performs automatic retries when connection error occurs or a 500-range response code received (except 501)
@@ -69,11 +69,11 @@ func NewPrClient(githubTokenPath, repoOwner, repoName, prNumStr, botUserName, co
 
 	prNum, err := strconv.Atoi(prNumStr)
 	if err != nil {
-		logrus.WithError(err).Fatalf("Failed to convert prNumStr(=%v) to int.\n", prNumStr)
+		return nil, fmt.Errorf("failed to convert prNumStr(=%v) to int: %v", prNumStr, err)
 	}
 	token, err := ioutil.ReadFile(githubTokenPath)
 	if err != nil {
-		logrus.WithError(err).Fatalf("Failed to get github token.\n")
+		return nil, fmt.Errorf("failed to get github token: %v", err)
 	}
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: strings.TrimSpace(string(token))},
@@ -90,7 +90,7 @@ func NewPrClient(githubTokenPath, repoOwner, repoName, prNumStr, botUserName, co
 		Ctx:           ctx,
 		opt:           &github.ListOptions{Page: 1},
 		GithubClient:  client,
-	}
+	}, nil
 }
 
 // CreateGithubComment post github comment of diff coverage
@@ -103,7 +103,7 @@ func (c *GitPrComment) CreateGithubComment(commentPrefix string, diffCovList cov
 
 	err = c.PostComment(content, commentPrefix)
 	if err != nil {
-		logrus.WithError(err).Fatalf("Post comment to github failed.")
+		return fmt.Errorf("post comment to github failed: %v", err)
 	}
 
 	return
@@ -88,9 +88,15 @@ func TestNewPrClient(t *testing.T) {
 	}
 
 	for _, tc := range items {
-		prClient := NewPrClient(tc.token, tc.repoOwner, tc.repoName, tc.prNumStr, tc.botUserName, tc.commentFlag)
+		prClient, err := NewPrClient(tc.token, tc.repoOwner, tc.repoName, tc.prNumStr, tc.botUserName, tc.commentFlag)
+		assert.NoError(t, err)
 		assert.Equal(t, tc.expectPrNum, prClient.PrNumber)
 	}
+
+	_, err := NewPrClient("github_test.go", "qiniu", "goc", "a", "qiniu-bot", "test")
+	assert.Error(t, err)
+	_, err = NewPrClient("nonexist", "qiniu", "goc", "1", "qiniu-bot", "test")
+	assert.Error(t, err)
 }
 
 func TestCreateGithubComment(t *testing.T) {
@@ -152,7 +152,10 @@ func (j *Job) WriteChangedCov(changedFiles []string) error {
 		logrus.Printf("Open file %s failed", j.LocalProfilePath)
 		return err
 	}
-	cp := j.LocalArtifacts.CreateChangedProfile()
+	cp, err := j.LocalArtifacts.CreateChangedProfile()
+	if err != nil {
+		return err
+	}
 	defer cp.Close()
 	s := bufio.NewScanner(bytes.NewReader(p))
 	s.Scan()
@@ -194,7 +194,8 @@ func TestRunPresubmitFulldiff(t *testing.T) {
 	//mock github client
 	setup(githubTokenPath, "")
 	defer os.Remove(path.Join(pwd, githubTokenPath))
-	prClient := github.NewPrClient(githubTokenPath, org, repo, prNum, robotName, githubCommentPrefix)
+	prClient, err := github.NewPrClient(githubTokenPath, org, repo, prNum, robotName, githubCommentPrefix)
+	assert.NoError(t, err)
 
 	j := &Job{
 		JobName:                jobName,
@@ -110,7 +110,7 @@ func FindBaseProfileFromQiniu(qc Client, prowJobName, covProfileName string) ([]
 // Artifacts is the interface of the rule to store test artifacts in prow
 type Artifacts interface {
 	ProfilePath() string
-	CreateChangedProfile() *os.File
+	CreateChangedProfile() (*os.File, error)
 	GetChangedProfileName() string
 }
 
@@ -127,17 +127,17 @@ func (a *ProfileArtifacts) ProfilePath() string {
 }
 
 // CreateChangedProfile creates a profile in order to store the most related files based on Github Pull Request
-func (a *ProfileArtifacts) CreateChangedProfile() *os.File {
+func (a *ProfileArtifacts) CreateChangedProfile() (*os.File, error) {
 	if a.ChangedProfileName == "" {
-		log.Fatalf("param Artifacts.ChangedProfileName should not be empty")
+		return nil, fmt.Errorf("param Artifacts.ChangedProfileName should not be empty")
 	}
 	p, err := os.Create(a.ChangedProfileName)
 	log.Printf("os create: %s", a.ChangedProfileName)
 	if err != nil {
-		log.Fatalf("file(%s) create failed: %v", a.ChangedProfileName, err)
+		return nil, fmt.Errorf("file(%s) create failed: %v", a.ChangedProfileName, err)
 	}
 
-	return p
+	return p, nil
 }
 
 // GetChangedProfileName get ChangedProfileName of the ProfileArtifacts
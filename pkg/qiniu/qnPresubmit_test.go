@@ -54,13 +54,20 @@ func TestProfileArtifacts_CreateChangedProfile(t *testing.T) {
 	p := &ProfileArtifacts{
 		ChangedProfileName: "test.cov",
 	}
-	file := p.CreateChangedProfile()
+	file, err := p.CreateChangedProfile()
+	assert.NoError(t, err)
 	file.Close()
 	defer os.Remove(p.ChangedProfileName)
-	_, err := os.Stat(p.ChangedProfileName)
+	_, err = os.Stat(p.ChangedProfileName)
 	assert.NoError(t, err)
 }
 
+func TestProfileArtifacts_CreateChangedProfileWithoutName(t *testing.T) {
+	p := &ProfileArtifacts{}
+	_, err := p.CreateChangedProfile()
+	assert.Error(t, err)
+}
+
 func TestProfileArtifacts_GetChangedProfileName(t *testing.T) {
 	p := &ProfileArtifacts{
 		ChangedProfileName: "change.cov",